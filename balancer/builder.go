@@ -0,0 +1,235 @@
+package balancer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// pickerBuilder 每个连接创建一个，可以保存跨picker的状态
+type pickerBuilder interface {
+	base.PickerBuilder
+
+	// update 地址更新时调用，随后会重新Build
+	update(balancer.ClientConnState)
+
+	// state 共用的连接状态
+	state() *connState
+}
+
+// builder 同 base.NewBalancerBuilder，但每个连接使用独立的 pickerBuilder
+type builder struct {
+	name             string
+	newPickerBuilder func() pickerBuilder
+}
+
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := b.newPickerBuilder()
+	cb := &customBalancer{pb: pb}
+	pb.state().stats = getStats(opts.Target.String())
+	pb.state().subset = newSubsetter(cb.refilter)
+	cb.Balancer = base.NewBalancerBuilder(b.name, &stickyPickerBuilder{pb}, base.Config{HealthCheck: true}).Build(&statsClientConn{
+		ClientConn: cc,
+		stats:      pb.state().stats,
+		subConns:   make(map[balancer.SubConn]string),
+		locker:     &cb.m,
+	}, opts)
+	return cb
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+// customBalancer 保存最近的地址，按需连接时重新划分子集，因此调用 base 负载均衡时加锁
+type customBalancer struct {
+	balancer.Balancer
+	pb pickerBuilder
+
+	m      sync.Mutex
+	last   *balancer.ClientConnState
+	closed bool
+}
+
+func (b *customBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.last = &s
+	return b.update(s)
+}
+
+func (b *customBalancer) update(s balancer.ClientConnState) error {
+	b.pb.update(s)
+	if c := b.pb.state(); c.cfg.SubsetSize > 0 {
+		s.ResolverState.Addresses = c.subset.filter(s.ResolverState.Addresses, c.cfg.SubsetSize, c.serviceID)
+	}
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// refilter 使用最近的地址重新划分子集
+func (b *customBalancer) refilter() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.closed || b.last == nil {
+		return
+	}
+	if err := b.update(*b.last); err != nil {
+		logger.Warningf("refilter: %v", err)
+	}
+}
+
+func (b *customBalancer) ResolverError(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.Balancer.ResolverError(err)
+}
+
+func (b *customBalancer) UpdateSubConnState(sc balancer.SubConn, s balancer.SubConnState) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.Balancer.UpdateSubConnState(sc, s)
+}
+
+func (b *customBalancer) Close() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closed = true
+	b.Balancer.Close()
+	putStats(b.pb.state().stats)
+}
+
+func (b *customBalancer) ExitIdle() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if ei, ok := b.Balancer.(balancer.ExitIdler); ok {
+		ei.ExitIdle()
+	}
+}
+
+// connState 各 pickerBuilder 共用的连接状态
+type connState struct {
+	md     metadata
+	cfg    *lbConfig
+	od     *outlierDetector
+	lim    *limiter
+	stats  *stats
+	subset *subsetter
+}
+
+func newConnState() connState {
+	return connState{
+		md:  make(metadata),
+		cfg: &lbConfig{},
+	}
+}
+
+func (c *connState) state() *connState {
+	return c
+}
+
+func (c *connState) update(s balancer.ClientConnState) {
+	c.md.update(s)
+	if cfg, ok := s.BalancerConfig.(*lbConfig); ok && cfg != c.cfg {
+		c.cfg = cfg
+		c.od, c.lim = nil, nil
+		if cfg.OutlierDetection != nil {
+			c.od = newOutlierDetector(cfg.OutlierDetection)
+		}
+		if cfg.Limit != nil {
+			c.lim = newLimiter(cfg.Limit)
+		}
+	}
+	addrs := make(map[string]bool, len(s.ResolverState.Addresses))
+	for _, addr := range s.ResolverState.Addresses {
+		addrs[addr.Addr] = true
+	}
+	c.stats.update(addrs)
+	if c.od != nil {
+		c.od.update(addrs)
+	}
+	if c.lim != nil {
+		c.lim.update(addrs)
+	}
+}
+
+func (c *connState) pinner(info base.PickerBuildInfo, scm map[string]balancer.SubConn) pinner {
+	addrs := make(map[balancer.SubConn]string, len(info.ReadySCs))
+	for sc, info := range info.ReadySCs {
+		addrs[sc] = info.Address.Addr
+	}
+	p := pinner{
+		subConnm: scm,
+		policy:   c.cfg.PinMissPolicy,
+		od:       c.od,
+		lim:      c.lim,
+		addrs:    addrs,
+		stats:    c.stats,
+	}
+	if c.cfg.SubsetSize > 0 {
+		p.subset = c.subset
+	}
+	return p
+}
+
+// serviceID 默认取发现元数据中的id，配置 idLabel 时取对应标签，兼容 etcd naming/resolver 的元数据
+func (c *connState) serviceID(addr resolver.Address) (string, bool) {
+	if md, ok := c.md.get(addr); ok {
+		if c.cfg.IDLabel == "" {
+			return strconv.Itoa(md.ID), true
+		}
+		id, ok := md.Labels[c.cfg.IDLabel]
+		return id, ok
+	}
+
+	id, ok := addr.Metadata.(string)
+	return id, ok
+}
+
+// weight 按 weightSource 取权重，未设置或无效时为1
+func (c *connState) weight(addr resolver.Address) int {
+	md, ok := c.md.get(addr)
+	if !ok {
+		return 1
+	}
+
+	w := md.Weight
+	switch src := c.cfg.WeightSource; {
+	case src == weightNone:
+		return 1
+	case strings.HasPrefix(string(src), weightLabelPrefix):
+		w, _ = strconv.Atoi(md.Labels[strings.TrimPrefix(string(src), weightLabelPrefix)])
+	}
+	return max(w, 1)
+}
+
+// ready 参与轮询的 SubConn 和按id索引的全部 SubConn，排空中和子集外按需连接的不参与轮询，
+// 全部排空时仍然轮询，避免没有可用实例
+func (c *connState) ready(info base.PickerBuildInfo) ([]balancer.SubConn, map[string]balancer.SubConn) {
+	scs := make([]balancer.SubConn, 0, len(info.ReadySCs))
+	scm := make(map[string]balancer.SubConn)
+	var draining []balancer.SubConn
+	for sc, info := range info.ReadySCs {
+		if c.md.draining(info.Address) || (c.cfg.SubsetSize > 0 && c.subset.isExtra(info.Address.Addr)) {
+			draining = append(draining, sc)
+		} else {
+			scs = append(scs, sc)
+		}
+		if id, ok := c.serviceID(info.Address); ok {
+			scm[id] = sc
+		}
+	}
+	if len(scs) == 0 {
+		scs = draining
+	}
+	return scs, scm
+}
@@ -0,0 +1,299 @@
+package balancer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+)
+
+// PinMissPolicy 指定的 ServiceID 没有就绪实例时的处理
+type PinMissPolicy int
+
+const (
+	// PinMissFallback 轮询其它实例
+	PinMissFallback PinMissPolicy = iota
+
+	// PinMissFail 返回 codes.Unavailable
+	PinMissFail
+
+	// PinMissWait 等待实例就绪，直到调用超时，被驱逐但仍就绪的实例直接使用
+	PinMissWait
+)
+
+func (p PinMissPolicy) String() string {
+	switch p {
+	case PinMissFallback:
+		return "fallback"
+	case PinMissFail:
+		return "fail"
+	case PinMissWait:
+		return "wait"
+	}
+	return fmt.Sprintf("PinMissPolicy(%d)", int(p))
+}
+
+func (p PinMissPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *PinMissPolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "fallback":
+		*p = PinMissFallback
+	case "fail":
+		*p = PinMissFail
+	case "wait":
+		*p = PinMissWait
+	default:
+		return fmt.Errorf("invalid pin miss policy %q", text)
+	}
+	return nil
+}
+
+// PinMiss 单次调用的 PinMissPolicy，优先于服务配置
+const PinMiss = ck("PinMiss")
+
+// weightSource 权重来源
+type weightSource string
+
+const (
+	// weightMetadata 发现元数据的 Weight，默认
+	weightMetadata weightSource = "weight"
+
+	// weightNone 忽略权重
+	weightNone weightSource = "none"
+
+	// weightLabelPrefix 发现元数据的标签，例如 "label:cores"
+	weightLabelPrefix = "label:"
+)
+
+func (w *weightSource) UnmarshalText(text []byte) error {
+	switch v := weightSource(text); {
+	case v == weightMetadata, v == weightNone:
+	case strings.HasPrefix(string(v), weightLabelPrefix) && len(v) > len(weightLabelPrefix):
+	default:
+		return fmt.Errorf("invalid weight source %q", text)
+	}
+	*w = weightSource(text)
+	return nil
+}
+
+// lbConfig loadBalancingConfig 中的配置，各负载均衡共用，未知字段视为错误，例如
+//
+//	{"loadBalancingConfig": [{"custom_round_robin": {"pinMissPolicy": "wait", "idLabel": "room"}}]}
+type lbConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	PinMissPolicy PinMissPolicy `json:"pinMissPolicy"`
+
+	// WeightSource "weight"、"none" 或 "label:<key>"
+	WeightSource weightSource `json:"weightSource"`
+
+	// IDLabel 为空时 ServiceID 为发现元数据的id，否则为对应标签
+	IDLabel string `json:"idLabel"`
+
+	// Replicas custom_ring_hash 每个实例的虚拟节点数，0时使用注册时的值
+	Replicas int `json:"replicas"`
+
+	// SubsetSize 每个客户端连接的实例数，0时连接全部
+	SubsetSize int `json:"subsetSize"`
+
+	// OutlierDetection 为空时不驱逐
+	OutlierDetection *outlierConfig `json:"outlierDetection"`
+
+	// Limit 为空时不限流
+	Limit *limitConfig `json:"limit"`
+}
+
+var errInvalidOutlierConfig = errors.New("invalid outlier detection config")
+
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &lbConfig{}
+	d := json.NewDecoder(bytes.NewReader(js))
+	d.DisallowUnknownFields()
+	if err := d.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.name, err)
+	}
+	if cfg.Replicas < 0 || cfg.Replicas > maxRingSize {
+		return nil, fmt.Errorf("%s: invalid replicas %d", b.name, cfg.Replicas)
+	}
+	if cfg.SubsetSize < 0 {
+		return nil, fmt.Errorf("%s: invalid subset size %d", b.name, cfg.SubsetSize)
+	}
+	if cfg.OutlierDetection != nil {
+		if err := cfg.OutlierDetection.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", b.name, err)
+		}
+	}
+	if cfg.Limit != nil {
+		if err := cfg.Limit.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", b.name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// duration 同 service config 中的时长，例如 "10s"
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// pinner 按 ServiceID 选择实例，各 picker 共用
+type pinner struct {
+	subConnm map[string]balancer.SubConn
+	policy   PinMissPolicy
+
+	// od 为空时不驱逐
+	od *outlierDetector
+
+	// lim 为空时不限流
+	lim   *limiter
+	addrs map[balancer.SubConn]string
+
+	stats *stats
+
+	// subset 为空时不划分子集
+	subset *subsetter
+}
+
+// ejected 被驱逐的实例不参与选择
+func (p *pinner) ejected(sc balancer.SubConn) bool {
+	return p.od != nil && p.od.ejected(p.addrs[sc])
+}
+
+// admit 超过限流时 ok 为false，否则记录调用结果用于驱逐和限流
+func (p *pinner) admit(sc balancer.SubConn) (balancer.PickResult, bool) {
+	addr := p.addrs[sc]
+
+	var release, record func(balancer.DoneInfo)
+	if p.lim != nil {
+		var ok bool
+		if release, ok = p.lim.acquire(addr); !ok {
+			return balancer.PickResult{}, false
+		}
+	}
+	if p.od != nil {
+		record = p.od.done(addr)
+	}
+
+	res := balancer.PickResult{SubConn: sc}
+	if release != nil || record != nil {
+		res.Done = func(info balancer.DoneInfo) {
+			if release != nil {
+				release(info)
+			}
+			if record != nil {
+				record(info)
+			}
+		}
+	}
+	return res, true
+}
+
+// choose 按顺序选择第一个未被驱逐且未超过限流的实例，超过限流时按 onLimit 继续尝试，
+// 全部被驱逐时仍然使用第一个
+func (p *pinner) choose(candidates iter.Seq[balancer.SubConn]) (balancer.PickResult, error) {
+	var first, limited balancer.SubConn
+	for sc := range candidates {
+		if first == nil {
+			first = sc
+		}
+		if p.ejected(sc) {
+			continue
+		}
+		res, ok := p.admit(sc)
+		if ok {
+			return res, nil
+		}
+		if limited == nil {
+			limited = sc
+		}
+		if p.lim.cfg.OnLimit != limitNext {
+			break
+		}
+	}
+
+	if limited == nil {
+		res, ok := p.admit(first)
+		if ok {
+			return res, nil
+		}
+		limited = first
+	}
+	return balancer.PickResult{}, p.limited(limited)
+}
+
+// rotate 从 start 开始依次返回全部实例
+func rotate(scs []balancer.SubConn, start uint32) iter.Seq[balancer.SubConn] {
+	return func(yield func(balancer.SubConn) bool) {
+		for i := range uint32(len(scs)) {
+			if !yield(scs[(start+i)%uint32(len(scs))]) {
+				return
+			}
+		}
+	}
+}
+
+// limited 超过限流的错误
+func (p *pinner) limited(sc balancer.SubConn) error {
+	return status.Errorf(codes.ResourceExhausted, "%s over limit", p.addrs[sc])
+}
+
+// pin 未指定 ServiceID 或按策略回退时 ok 为false，由调用方继续选择
+func (p *pinner) pin(pi balancer.PickInfo) (balancer.PickResult, bool, error) {
+	id, ok := pi.Ctx.Value(ServiceID).(string)
+	if !ok {
+		return balancer.PickResult{}, false, nil
+	}
+
+	policy := p.policy
+	if v, ok := pi.Ctx.Value(PinMiss).(PinMissPolicy); ok {
+		policy = v
+	}
+
+	// 驱逐结束时不会生成新的 picker，等待时直接使用被驱逐但仍就绪的实例
+	if sc, ok := p.subConnm[id]; ok && (!p.ejected(sc) || policy == PinMissWait) {
+		p.stats.pin(true, false)
+		if p.subset != nil {
+			p.subset.used(id)
+		}
+		res, ok := p.admit(sc)
+		if !ok {
+			return res, true, p.limited(sc)
+		}
+		return res, true, nil
+	}
+
+	if p.subset != nil && p.subset.want(id) {
+		p.stats.pin(false, false)
+		return balancer.PickResult{}, true, balancer.ErrNoSubConnAvailable
+	}
+
+	p.stats.pin(false, policy == PinMissFallback)
+
+	switch policy {
+	case PinMissFail:
+		return balancer.PickResult{}, true, status.Errorf(codes.Unavailable, "service id %s not available", id)
+	case PinMissWait:
+		// 新的 picker 生成后重试
+		return balancer.PickResult{}, true, balancer.ErrNoSubConnAvailable
+	}
+
+	return balancer.PickResult{}, false, nil
+}
@@ -0,0 +1,244 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/panshiqu/golang/discovery"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	testgrpc "google.golang.org/grpc/interop/grpc_testing"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testServer 返回id作为 Hostname，流式调用时作为 Payload
+type testServer struct {
+	testgrpc.UnimplementedTestServiceServer
+
+	id  int
+	md  discovery.Metadata
+	lis *bufconn.Listener
+	srv *grpc.Server
+}
+
+func (s *testServer) UnaryCall(context.Context, *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	return &testpb.SimpleResponse{Hostname: strconv.Itoa(s.id)}, nil
+}
+
+func (s *testServer) StreamingOutputCall(_ *testpb.StreamingOutputCallRequest, stream testgrpc.TestService_StreamingOutputCallServer) error {
+	return stream.Send(&testpb.StreamingOutputCallResponse{Payload: &testpb.Payload{Body: []byte(strconv.Itoa(s.id))}})
+}
+
+func (s *testServer) addr() string {
+	return fmt.Sprintf("server-%d", s.id)
+}
+
+// harness 进程内的 bufconn 服务器，通过 manual resolver 交给负载均衡
+type harness struct {
+	t *testing.T
+	r *manual.Resolver
+
+	m       sync.Mutex
+	servers map[int]*testServer // id -> 服务器，按id注册到resolver
+
+	cc     *grpc.ClientConn
+	client testgrpc.TestServiceClient
+}
+
+// newHarness 启动id为1到n的服务器，lbConfig 为负载均衡配置，例如 `{"custom_round_robin":{}}`
+func newHarness(t *testing.T, lbConfig string, n int, opts ...grpc.DialOption) *harness {
+	t.Helper()
+
+	h := &harness{
+		t:       t,
+		r:       manual.NewBuilderWithScheme("harness"),
+		servers: make(map[int]*testServer),
+	}
+
+	for id := 1; id <= n; id++ {
+		h.start(id, discovery.Metadata{ID: id})
+	}
+	h.r.InitialState(h.state())
+
+	cc, err := grpc.NewClient(h.r.Scheme()+":///test", append([]grpc.DialOption{
+		grpc.WithResolvers(h.r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(h.dial),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[` + lbConfig + `]}`),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.cc = cc
+	h.client = testgrpc.NewTestServiceClient(cc)
+
+	t.Cleanup(func() {
+		cc.Close()
+		h.m.Lock()
+		defer h.m.Unlock()
+		for _, s := range h.servers {
+			s.srv.Stop()
+		}
+	})
+
+	return h
+}
+
+func (h *harness) start(id int, md discovery.Metadata) {
+	s := &testServer{
+		id:  id,
+		md:  md,
+		lis: bufconn.Listen(1 << 20),
+		srv: grpc.NewServer(),
+	}
+	testgrpc.RegisterTestServiceServer(s.srv, s)
+	go s.srv.Serve(s.lis)
+
+	h.m.Lock()
+	h.servers[id] = s
+	h.m.Unlock()
+}
+
+func (h *harness) dial(ctx context.Context, addr string) (net.Conn, error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	for _, s := range h.servers {
+		if s.addr() == addr {
+			return s.lis.DialContext(ctx)
+		}
+	}
+	return nil, fmt.Errorf("unknown addr %s", addr)
+}
+
+func (h *harness) state() resolver.State {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	var state resolver.State
+	for _, s := range h.servers {
+		md := s.md
+		state.Addresses = append(state.Addresses, discovery.SetMetadata(resolver.Address{Addr: s.addr()}, &md))
+	}
+	return state
+}
+
+// add 启动服务器并更新resolver
+func (h *harness) add(id int, md discovery.Metadata) {
+	h.start(id, md)
+	h.r.UpdateState(h.state())
+}
+
+// update 修改元数据并更新resolver
+func (h *harness) update(id int, fn func(*discovery.Metadata)) {
+	h.m.Lock()
+	fn(&h.servers[id].md)
+	h.m.Unlock()
+
+	h.r.UpdateState(h.state())
+}
+
+// stop 停止服务器但不从resolver移除，用于故障转移
+func (h *harness) stop(id int) {
+	h.m.Lock()
+	s := h.servers[id]
+	h.m.Unlock()
+
+	s.srv.Stop()
+}
+
+// remove 停止服务器并从resolver移除
+func (h *harness) remove(id int) {
+	h.m.Lock()
+	s := h.servers[id]
+	delete(h.servers, id)
+	h.m.Unlock()
+
+	s.srv.Stop()
+	h.r.UpdateState(h.state())
+}
+
+// call 返回服务器id
+func (h *harness) call(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	resp, err := h.client.UnaryCall(ctx, &testpb.SimpleRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(resp.Hostname)
+}
+
+// stream 通过流式调用返回服务器id
+func (h *harness) stream(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	stream, err := h.client.StreamingOutputCall(ctx, &testpb.StreamingOutputCallRequest{})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(resp.Payload.Body))
+}
+
+// pin 指定 ServiceID 调用
+func (h *harness) pin(ctx context.Context, id int) (int, error) {
+	return h.call(context.WithValue(ctx, ServiceID, strconv.Itoa(id)))
+}
+
+// distribution n 次调用在各服务器的分布
+func (h *harness) distribution(ctx context.Context, n int) map[int]int {
+	h.t.Helper()
+
+	dist := make(map[int]int)
+	for range n {
+		id, err := h.call(ctx)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		dist[id]++
+	}
+	return dist
+}
+
+// await 等待直到连续的调用只落在ids上且全部覆盖
+func (h *harness) await(ids ...int) {
+	h.t.Helper()
+
+	want := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		seen := make(map[int]bool)
+		ok := true
+		for range 2 * len(ids) {
+			id, err := h.call(context.Background())
+			if err != nil || !want[id] {
+				ok = false
+				break
+			}
+			seen[id] = true
+		}
+		if ok && len(seen) == len(want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.t.Fatalf("await %v timeout", ids)
+}
@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	grpcmetadata "google.golang.org/grpc/metadata"
+)
+
+// ServiceIDHeader 传递 ServiceID 的 gRPC 元数据
+const ServiceIDHeader = "x-service-id"
+
+// UnaryClientInterceptor 上下文中的 ServiceID 写入请求元数据，
+// 仅有元数据时写入上下文供 picker 使用
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor 请求元数据中的 ServiceID 写入上下文，
+// 网关转发时由 UnaryClientInterceptor 继续传递，后端服务不应使用，避免传给无关的服务
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(incoming(ctx), req)
+	}
+}
+
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: incoming(ss.Context())})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func outgoing(ctx context.Context) context.Context {
+	md, _ := grpcmetadata.FromOutgoingContext(ctx)
+	v := md.Get(ServiceIDHeader)
+
+	// 两者都有时以上下文为准
+	if id, ok := ctx.Value(ServiceID).(string); ok {
+		if len(v) == 1 && v[0] == id {
+			return ctx
+		}
+		md = md.Copy()
+		md.Set(ServiceIDHeader, id)
+		return grpcmetadata.NewOutgoingContext(ctx, md)
+	}
+
+	if len(v) > 0 {
+		return context.WithValue(ctx, ServiceID, v[0])
+	}
+	return ctx
+}
+
+func incoming(ctx context.Context) context.Context {
+	if v := grpcmetadata.ValueFromIncomingContext(ctx, ServiceIDHeader); len(v) > 0 {
+		return context.WithValue(ctx, ServiceID, v[0])
+	}
+	return ctx
+}
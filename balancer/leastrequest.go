@@ -0,0 +1,118 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// LeastRequestName 随机选择两个实例，取进行中调用较少的一个
+const LeastRequestName = "custom_least_request"
+
+func newLeastRequestBuilder() balancer.Builder {
+	return &builder{
+		name: LeastRequestName,
+		newPickerBuilder: func() pickerBuilder {
+			return &lrPickerBuilder{
+				connState: newConnState(),
+				inflight:  make(map[balancer.SubConn]*atomic.Int64),
+			}
+		},
+	}
+}
+
+func init() {
+	balancer.Register(newLeastRequestBuilder())
+}
+
+type lrPickerBuilder struct {
+	connState
+
+	// 跨picker保留，重新Build时计数不清零
+	inflight map[balancer.SubConn]*atomic.Int64
+}
+
+func (b *lrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	logger.Infof("leastRequestPicker: Build called with info: %v", info)
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	for sc := range b.inflight {
+		if _, ok := info.ReadySCs[sc]; !ok {
+			delete(b.inflight, sc)
+		}
+	}
+	inflight := make(map[balancer.SubConn]*atomic.Int64, len(info.ReadySCs))
+	for sc := range info.ReadySCs {
+		if _, ok := b.inflight[sc]; !ok {
+			b.inflight[sc] = new(atomic.Int64)
+		}
+		inflight[sc] = b.inflight[sc]
+	}
+	scs, scm := b.ready(info)
+	return &lrPicker{
+		pinner:   b.pinner(info, scm),
+		subConns: scs,
+		inflight: inflight,
+	}
+}
+
+type lrPicker struct {
+	pinner
+	subConns []balancer.SubConn
+	inflight map[balancer.SubConn]*atomic.Int64
+}
+
+func (p *lrPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	if res, ok, err := p.pin(pi); ok {
+		if err != nil {
+			return res, err
+		}
+		return p.track(res), nil
+	}
+
+	start := rand.Intn(len(p.subConns))
+	sc := p.subConns[start]
+	if n := len(p.subConns); n > 1 {
+		i := rand.Intn(n - 1)
+		if p.subConns[i] == sc {
+			i = n - 1
+		}
+		if other := p.subConns[i]; p.inflight[other].Load() < p.inflight[sc].Load() {
+			sc = other
+		}
+	}
+
+	// 实例被驱逐或超过限流时依次选择其它实例
+	res, err := p.choose(func(yield func(balancer.SubConn) bool) {
+		if !yield(sc) {
+			return
+		}
+		for other := range rotate(p.subConns, uint32(start)) {
+			if other != sc && !yield(other) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return res, err
+	}
+	return p.track(res), nil
+}
+
+// track 调用结束时减少计数
+func (p *lrPicker) track(res balancer.PickResult) balancer.PickResult {
+	n := p.inflight[res.SubConn]
+	n.Add(1)
+
+	done := res.Done
+	res.Done = func(info balancer.DoneInfo) {
+		n.Add(-1)
+		if done != nil {
+			done(info)
+		}
+	}
+	return res
+}
@@ -0,0 +1,137 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+)
+
+// limitPolicy 超过限制时的处理
+type limitPolicy string
+
+const (
+	// limitReject 返回 codes.ResourceExhausted，默认
+	limitReject limitPolicy = "reject"
+
+	// limitNext 按各负载均衡的顺序选择下一个实例，全部超过时拒绝，ServiceID 调用仍然拒绝
+	limitNext limitPolicy = "next"
+)
+
+func (p *limitPolicy) UnmarshalText(text []byte) error {
+	switch v := limitPolicy(text); v {
+	case limitReject, limitNext:
+		*p = v
+	default:
+		return fmt.Errorf("invalid limit policy %q", text)
+	}
+	return nil
+}
+
+// limitConfig 每个实例的限流，在发送调用前检查，例如
+//
+//	{"limit": {"qps": 100, "maxConcurrency": 20, "onLimit": "next"}}
+type limitConfig struct {
+	// QPS 令牌桶速率，0不限
+	QPS float64 `json:"qps"`
+
+	// Burst 令牌桶容量，默认为QPS向上取整
+	Burst int `json:"burst"`
+
+	// MaxConcurrency 最大进行中调用数，0不限
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	OnLimit limitPolicy `json:"onLimit"`
+}
+
+var errInvalidLimitConfig = errors.New("invalid limit config")
+
+func (c *limitConfig) validate() error {
+	if c.QPS < 0 || math.IsInf(c.QPS, 0) || math.IsNaN(c.QPS) || c.Burst < 0 || c.MaxConcurrency < 0 {
+		return errInvalidLimitConfig
+	}
+
+	if c.Burst == 0 {
+		c.Burst = max(1, int(math.Ceil(c.QPS)))
+	}
+	if c.OnLimit == "" {
+		c.OnLimit = limitReject
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	inflight int
+}
+
+// limiter 每个实例一个令牌桶，跨picker保留
+type limiter struct {
+	cfg *limitConfig
+
+	m       sync.Mutex
+	buckets map[string]*bucket // 地址 -> 令牌桶
+}
+
+func newLimiter(cfg *limitConfig) *limiter {
+	return &limiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// update 地址更新时移除已下线实例的令牌桶
+func (l *limiter) update(addrs map[string]bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for addr := range l.buckets {
+		if !addrs[addr] {
+			delete(l.buckets, addr)
+		}
+	}
+	for addr := range addrs {
+		if _, ok := l.buckets[addr]; !ok {
+			l.buckets[addr] = &bucket{tokens: float64(l.cfg.Burst), last: time.Now()}
+		}
+	}
+}
+
+// acquire 取得令牌和并发数，调用结束时释放并发数
+func (l *limiter) acquire(addr string) (func(balancer.DoneInfo), bool) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	b, ok := l.buckets[addr]
+	if !ok {
+		return nil, true
+	}
+
+	if l.cfg.QPS > 0 {
+		now := time.Now()
+		b.tokens = min(float64(l.cfg.Burst), b.tokens+now.Sub(b.last).Seconds()*l.cfg.QPS)
+		b.last = now
+		if b.tokens < 1 {
+			return nil, false
+		}
+	}
+	if l.cfg.MaxConcurrency > 0 && b.inflight >= l.cfg.MaxConcurrency {
+		return nil, false
+	}
+
+	if l.cfg.QPS > 0 {
+		b.tokens--
+	}
+	b.inflight++
+
+	return func(balancer.DoneInfo) {
+		l.m.Lock()
+		defer l.m.Unlock()
+
+		b.inflight--
+	}, true
+}
@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimitReject(t *testing.T) {
+	h := newHarness(t, `{"custom_round_robin":{"limit":{"qps":0.01,"burst":2}}}`, 1)
+
+	for range 2 {
+		if _, err := h.call(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.call(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("over limit %v", err)
+	}
+	if _, err := h.pin(context.Background(), 1); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("pin over limit %v", err)
+	}
+}
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestLimitNext(t *testing.T) {
+	cfg := &limitConfig{QPS: 0.01, Burst: 2, OnLimit: limitNext}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	lim := newLimiter(cfg)
+	lim.update(map[string]bool{"a": true, "b": true})
+
+	a, b := &fakeSubConn{}, &fakeSubConn{}
+	p := &rrPicker{
+		pinner:   pinner{lim: lim, addrs: map[balancer.SubConn]string{a: "a", b: "b"}},
+		subConns: []balancer.SubConn{a, b},
+	}
+	pi := balancer.PickInfo{Ctx: context.Background()}
+
+	// 用完b的令牌，轮询到b时选择a
+	for range 2 {
+		if _, ok := lim.acquire("b"); !ok {
+			t.Fatal("acquire b")
+		}
+	}
+	for range 2 {
+		res, err := p.Pick(pi)
+		if err != nil || res.SubConn != a {
+			t.Fatalf("pick %v %v", res.SubConn, err)
+		}
+	}
+
+	if _, err := p.Pick(pi); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("over limit %v", err)
+	}
+}
+
+func TestLimitPickers(t *testing.T) {
+	for name, pb := range pickers() {
+		cfg := &limitConfig{QPS: 0.01, Burst: 1}
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		lim := newLimiter(cfg)
+		lim.update(map[string]bool{"a": true, "b": true, "c": true})
+		pb.state().lim = lim
+
+		info, scs := buildInfo()
+		p := pb.Build(info)
+		for _, addr := range []string{"a", "b", "c"} {
+			if _, ok := lim.acquire(addr); !ok {
+				t.Fatalf("acquire %s", addr)
+			}
+		}
+		if _, err := p.Pick(balancer.PickInfo{Ctx: context.Background()}); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("%s over limit %v", name, err)
+		}
+
+		// 选择下一个未超过限流的实例
+		cfg.OnLimit = limitNext
+		lim.update(map[string]bool{})
+		lim.update(map[string]bool{"a": true, "b": true, "c": true})
+		if _, ok := lim.acquire("a"); !ok {
+			t.Fatal("acquire a")
+		}
+		for range 2 {
+			res, err := p.Pick(balancer.PickInfo{Ctx: context.Background()})
+			if err != nil || res.SubConn == scs["a"] {
+				t.Fatalf("%s next %v", name, err)
+			}
+		}
+	}
+}
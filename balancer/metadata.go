@@ -0,0 +1,40 @@
+package balancer
+
+import (
+	"github.com/panshiqu/golang/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+)
+
+// metadata 最新的发现元数据，base balancer 保存的地址不会随元数据更新
+type metadata map[string]*discovery.Metadata
+
+func (m metadata) update(s balancer.ClientConnState) {
+	clear(m)
+	for _, addr := range s.ResolverState.Addresses {
+		if md, ok := getMetadata(addr); ok {
+			m[addr.Addr] = md
+		}
+	}
+}
+
+func (m metadata) get(addr resolver.Address) (*discovery.Metadata, bool) {
+	if md, ok := m[addr.Addr]; ok {
+		return md, true
+	}
+	return getMetadata(addr)
+}
+
+// getMetadata 兼容etcd naming/resolver，元数据在 Metadata 中且为json解码后的对象
+func getMetadata(addr resolver.Address) (*discovery.Metadata, bool) {
+	if md, ok := discovery.GetMetadata(addr); ok {
+		return md, true
+	}
+	return discovery.EndpointMetadata(addr.Metadata)
+}
+
+// draining 排空中的实例不参与轮询
+func (m metadata) draining(addr resolver.Address) bool {
+	md, ok := m.get(addr)
+	return ok && md.Draining
+}
@@ -0,0 +1,25 @@
+package balancer
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestServiceIDEndpointMetadata(t *testing.T) {
+	c := newConnState()
+
+	// etcd naming/resolver 传入的json对象和旧格式的id字符串
+	addr := resolver.Address{Addr: "a:1", Metadata: map[string]any{"id": float64(7), "labels": map[string]any{"room": "r7"}}}
+	if id, ok := c.serviceID(addr); !ok || id != "7" {
+		t.Fatalf("object id %q %v", id, ok)
+	}
+	if id, ok := c.serviceID(resolver.Address{Addr: "a:2", Metadata: "8"}); !ok || id != "8" {
+		t.Fatalf("string id %q %v", id, ok)
+	}
+
+	c.cfg = &lbConfig{IDLabel: "room"}
+	if id, ok := c.serviceID(addr); !ok || id != "r7" {
+		t.Fatalf("label id %q %v", id, ok)
+	}
+}
@@ -0,0 +1,175 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// outlierConfig 异常实例驱逐，例如
+//
+//	{"outlierDetection": {"consecutiveFailures": 5, "baseEjectionTime": "30s"}}
+type outlierConfig struct {
+	// ConsecutiveFailures 连续失败次数，0不检测
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	// FailurePercent 统计窗口内的失败百分比，0不检测
+	FailurePercent int `json:"failurePercent"`
+
+	// MinRequests 窗口内调用次数达到后才按百分比检测
+	MinRequests int `json:"minRequests"`
+
+	// Interval 统计窗口，默认10秒
+	Interval duration `json:"interval"`
+
+	// BaseEjectionTime 首次驱逐时长，再次驱逐时翻倍，默认30秒
+	BaseEjectionTime duration `json:"baseEjectionTime"`
+
+	// MaxEjectionTime 最长驱逐时长，默认300秒
+	MaxEjectionTime duration `json:"maxEjectionTime"`
+
+	// MaxEjectedPercent 最多驱逐的实例百分比，默认10，至少允许驱逐一个但不会全部驱逐
+	MaxEjectedPercent int `json:"maxEjectedPercent"`
+}
+
+func (c *outlierConfig) validate() error {
+	if c.ConsecutiveFailures < 0 || c.MinRequests < 0 ||
+		c.FailurePercent < 0 || c.FailurePercent > 100 ||
+		c.MaxEjectedPercent < 0 || c.MaxEjectedPercent > 100 ||
+		c.Interval < 0 || c.BaseEjectionTime < 0 || c.MaxEjectionTime < 0 {
+		return errInvalidOutlierConfig
+	}
+
+	if c.Interval == 0 {
+		c.Interval = duration(10 * time.Second)
+	}
+	if c.BaseEjectionTime == 0 {
+		c.BaseEjectionTime = duration(30 * time.Second)
+	}
+	if c.MaxEjectionTime == 0 {
+		c.MaxEjectionTime = duration(300 * time.Second)
+	}
+	if c.MaxEjectedPercent == 0 {
+		c.MaxEjectedPercent = 10
+	}
+	return nil
+}
+
+// failure 服务端异常才计入失败，业务错误不计入
+func failure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+type outlierStat struct {
+	consecutive int
+	calls       int
+	failures    int
+	window      time.Time // 当前窗口开始时间
+	ejections   int       // 连续驱逐次数
+	until       time.Time // 驱逐结束时间
+}
+
+// outlierDetector 按调用结果驱逐异常实例，跨picker保留
+type outlierDetector struct {
+	cfg *outlierConfig
+
+	m     sync.Mutex
+	stats map[string]*outlierStat // 地址 -> 统计
+}
+
+func newOutlierDetector(cfg *outlierConfig) *outlierDetector {
+	return &outlierDetector{
+		cfg:   cfg,
+		stats: make(map[string]*outlierStat),
+	}
+}
+
+// update 地址更新时移除已下线实例的统计
+func (d *outlierDetector) update(addrs map[string]bool) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	for addr := range d.stats {
+		if !addrs[addr] {
+			delete(d.stats, addr)
+		}
+	}
+	for addr := range addrs {
+		if _, ok := d.stats[addr]; !ok {
+			d.stats[addr] = &outlierStat{window: time.Now()}
+		}
+	}
+}
+
+func (d *outlierDetector) ejected(addr string) bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	s, ok := d.stats[addr]
+	return ok && time.Now().Before(s.until)
+}
+
+// done 记录调用结果，达到阈值时驱逐
+func (d *outlierDetector) done(addr string) func(balancer.DoneInfo) {
+	return func(info balancer.DoneInfo) {
+		d.m.Lock()
+		defer d.m.Unlock()
+
+		s, ok := d.stats[addr]
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		if now.Sub(s.window) >= time.Duration(d.cfg.Interval) {
+			// 驱逐结束后一个窗口内没有失败，恢复驱逐时长
+			if s.failures == 0 && now.After(s.until) {
+				s.ejections = 0
+			}
+			s.calls, s.failures, s.window = 0, 0, now
+		}
+
+		s.calls++
+		if !failure(info.Err) {
+			s.consecutive = 0
+			return
+		}
+		s.consecutive++
+		s.failures++
+
+		if now.Before(s.until) {
+			return
+		}
+		if (d.cfg.ConsecutiveFailures == 0 || s.consecutive < d.cfg.ConsecutiveFailures) &&
+			(d.cfg.FailurePercent == 0 || s.calls < d.cfg.MinRequests || s.failures*100 < s.calls*d.cfg.FailurePercent) {
+			return
+		}
+
+		ejected := 0
+		for _, v := range d.stats {
+			if now.Before(v.until) {
+				ejected++
+			}
+		}
+		if ejected >= max(1, len(d.stats)*d.cfg.MaxEjectedPercent/100) || ejected+1 >= len(d.stats) {
+			return
+		}
+
+		t := min(time.Duration(d.cfg.BaseEjectionTime)<<min(s.ejections, 16), time.Duration(d.cfg.MaxEjectionTime))
+		s.until = now.Add(t)
+		s.ejections++
+		s.consecutive, s.calls, s.failures, s.window = 0, 0, 0, now
+
+		logger.Warningf("outlier: eject %s for %v", addr, t)
+	}
+}
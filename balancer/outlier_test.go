@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+func TestOutlierPinEjected(t *testing.T) {
+	cfg := &outlierConfig{ConsecutiveFailures: 1, MaxEjectedPercent: 50}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	od := newOutlierDetector(cfg)
+	od.update(map[string]bool{"a": true, "b": true})
+	od.done("a")(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "")})
+	if !od.ejected("a") {
+		t.Fatal("not ejected")
+	}
+
+	a, b := &fakeSubConn{}, &fakeSubConn{}
+	p := &rrPicker{
+		pinner: pinner{
+			subConnm: map[string]balancer.SubConn{"1": a, "2": b},
+			od:       od,
+			addrs:    map[balancer.SubConn]string{a: "a", b: "b"},
+		},
+		subConns: []balancer.SubConn{a, b},
+	}
+	ctx := context.WithValue(context.Background(), ServiceID, "1")
+
+	// 默认回退到未被驱逐的实例
+	if res, err := p.Pick(balancer.PickInfo{Ctx: ctx}); err != nil || res.SubConn != b {
+		t.Fatalf("fallback %v %v", res.SubConn, err)
+	}
+
+	// 等待时直接使用，驱逐结束不会重新生成 picker
+	ctx = context.WithValue(ctx, PinMiss, PinMissWait)
+	if res, err := p.Pick(balancer.PickInfo{Ctx: ctx}); err != nil || res.SubConn != a {
+		t.Fatalf("wait %v %v", res.SubConn, err)
+	}
+}
+
+// pickers 各负载均衡的 pickerBuilder
+func pickers() map[string]pickerBuilder {
+	builders := []balancer.Builder{
+		newBuilder(),
+		newWeightedBuilder(),
+		NewRingHashBuilder(RingHashName, defaultReplicas),
+		newLeastRequestBuilder(),
+		NewZoneBuilder("zone", ZoneConfig{}),
+	}
+
+	pbs := make(map[string]pickerBuilder, len(builders))
+	for _, b := range builders {
+		pbs[b.Name()] = b.(*builder).newPickerBuilder()
+	}
+	return pbs
+}
+
+// buildInfo 地址为 a、b、c 的就绪 SubConn
+func buildInfo() (base.PickerBuildInfo, map[string]balancer.SubConn) {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	scs := make(map[string]balancer.SubConn)
+	for _, addr := range []string{"a", "b", "c"} {
+		sc := &fakeSubConn{}
+		info.ReadySCs[sc] = base.SubConnInfo{Address: resolver.Address{Addr: addr}}
+		scs[addr] = sc
+	}
+	return info, scs
+}
+
+func TestOutlierPickers(t *testing.T) {
+	for name, pb := range pickers() {
+		cfg := &outlierConfig{ConsecutiveFailures: 1, MaxEjectedPercent: 50}
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		od := newOutlierDetector(cfg)
+		od.update(map[string]bool{"a": true, "b": true, "c": true})
+		od.done("a")(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "")})
+		pb.state().od = od
+
+		info, scs := buildInfo()
+		p := pb.Build(info)
+		for i := range 30 {
+			ctx := context.WithValue(context.Background(), HashKey, strconv.Itoa(i))
+			res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+			if err != nil || res.SubConn == scs["a"] {
+				t.Fatalf("%s pick ejected %v", name, err)
+			}
+			if res.Done != nil {
+				res.Done(balancer.DoneInfo{})
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package balancer
+
+import (
+	"cmp"
+	"hash/fnv"
+	"math/rand"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// RingHashName 一致性哈希，按 HashKey 选择实例
+const RingHashName = "custom_ring_hash"
+
+// 每个实例的虚拟节点数
+const defaultReplicas = 100
+
+// 环上虚拟节点总数的上限，超过时按权重等比缩减，同gRPC ring_hash的 maxRingSize
+const maxRingSize = 1 << 16
+
+// NewRingHashBuilder 每个实例 replicas*权重 个虚拟节点，虚拟节点越多分布越均匀，
+// 服务配置的 replicas 优先
+func NewRingHashBuilder(name string, replicas int) balancer.Builder {
+	return &builder{
+		name: name,
+		newPickerBuilder: func() pickerBuilder {
+			return &ringPickerBuilder{connState: newConnState(), replicas: max(replicas, 1)}
+		},
+	}
+}
+
+func init() {
+	balancer.Register(NewRingHashBuilder(RingHashName, defaultReplicas))
+}
+
+type ringPickerBuilder struct {
+	connState
+	replicas int
+}
+
+func (b *ringPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	logger.Infof("ringHashPicker: Build called with info: %v", info)
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	scs, scm := b.ready(info)
+	p := &ringPicker{
+		pinner:   b.pinner(info, scm),
+		subConns: scs,
+		next:     uint32(rand.Intn(len(scs))),
+	}
+	replicas := b.replicas
+	if b.cfg.Replicas > 0 {
+		replicas = b.cfg.Replicas
+	}
+	counts := make([]int, len(scs))
+	total := 0
+	for i, sc := range scs {
+		counts[i] = replicas * b.weight(info.ReadySCs[sc].Address)
+		total += counts[i]
+	}
+	if total > maxRingSize {
+		for i := range counts {
+			counts[i] = max(1, int(float64(counts[i])*maxRingSize/float64(total)))
+		}
+	}
+	for j, sc := range scs {
+		// 以地址计算虚拟节点，实例增减时其它实例的位置不变
+		addr := info.ReadySCs[sc].Address
+		for i := range counts[j] {
+			p.ring = append(p.ring, ringEntry{
+				hash: hash(addr.Addr + "_" + strconv.Itoa(i)),
+				sc:   sc,
+			})
+		}
+	}
+	slices.SortFunc(p.ring, func(a, b ringEntry) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+	return p
+}
+
+type ringEntry struct {
+	hash uint64
+	sc   balancer.SubConn
+}
+
+type ringPicker struct {
+	pinner
+	ring     []ringEntry
+	subConns []balancer.SubConn
+	next     uint32
+}
+
+// Pick 优先 ServiceID，其次 HashKey，都没有时轮询
+func (p *ringPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	if res, ok, err := p.pin(pi); ok {
+		return res, err
+	}
+
+	if key, ok := pi.Ctx.Value(HashKey).(string); ok {
+		h := hash(key)
+		i, _ := slices.BinarySearchFunc(p.ring, h, func(e ringEntry, h uint64) int {
+			return cmp.Compare(e.hash, h)
+		})
+		// 实例被驱逐或超过限流时沿环选择下一个实例
+		return p.choose(func(yield func(balancer.SubConn) bool) {
+			seen := make(map[balancer.SubConn]bool, len(p.subConns))
+			for j := range len(p.ring) {
+				sc := p.ring[(i+j)%len(p.ring)].sc
+				if seen[sc] {
+					continue
+				}
+				if !yield(sc) || len(seen)+1 == len(p.subConns) {
+					return
+				}
+				seen[sc] = true
+			}
+		})
+	}
+
+	nextIndex := atomic.AddUint32(&p.next, 1)
+	return p.choose(rotate(p.subConns, nextIndex))
+}
+
+// hash 各客户端结果一致，相同的键选择相同的实例
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	// fnv对相近的字符串分布不均，再混合一次
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// HashKey 一致性哈希的键，例如玩家id或房间id
+const HashKey = ck("HashKey")
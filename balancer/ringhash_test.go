@@ -0,0 +1,73 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/panshiqu/golang/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+// ringPick 按 HashKey 选择的实例地址
+func ringPick(t *testing.T, p balancer.Picker, key string) string {
+	t.Helper()
+
+	res, err := p.Pick(balancer.PickInfo{Ctx: context.WithValue(context.Background(), HashKey, key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.SubConn.(*fakeSubConn).addr
+}
+
+func TestRingHashStable(t *testing.T) {
+	pb := pickers()[RingHashName]
+	info, scs := buildInfo()
+	for addr, sc := range scs {
+		sc.(*fakeSubConn).addr = addr
+	}
+
+	before := make(map[string]string)
+	p := pb.Build(info)
+	for i := range 1000 {
+		key := strconv.Itoa(i)
+		before[key] = ringPick(t, p, key)
+	}
+
+	// 重新生成时结果不变
+	p = pb.Build(info)
+	for key, addr := range before {
+		if got := ringPick(t, p, key); got != addr {
+			t.Fatalf("rebuild %s %s -> %s", key, addr, got)
+		}
+	}
+
+	// 移除实例时只有它的键重新分配
+	delete(info.ReadySCs, scs["c"])
+	p = pb.Build(info)
+	for key, addr := range before {
+		if got := ringPick(t, p, key); addr != "c" && got != addr {
+			t.Fatalf("remove %s %s -> %s", key, addr, got)
+		}
+	}
+}
+
+func TestRingHashSize(t *testing.T) {
+	pb := pickers()[RingHashName]
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		&fakeSubConn{}: {Address: discovery.SetMetadata(resolver.Address{Addr: "a"}, &discovery.Metadata{ID: 1, Weight: 10000})},
+		&fakeSubConn{}: {Address: discovery.SetMetadata(resolver.Address{Addr: "b"}, &discovery.Metadata{ID: 2, Weight: 1})},
+	}}
+
+	if n := len(pb.Build(info).(*ringPicker).ring); n > maxRingSize {
+		t.Fatalf("ring size %d", n)
+	}
+
+	// 服务配置的虚拟节点数
+	pb.state().cfg = &lbConfig{Replicas: 2}
+	if n := len(pb.Build(info).(*ringPicker).ring); n != 2*10001 {
+		t.Fatalf("replicas ring size %d", n)
+	}
+}
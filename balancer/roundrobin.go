@@ -37,31 +37,31 @@ var logger = grpclog.Component("roundrobin")
 
 // newBuilder creates a new roundrobin balancer builder.
 func newBuilder() balancer.Builder {
-	return base.NewBalancerBuilder(Name, &rrPickerBuilder{}, base.Config{HealthCheck: true})
+	return &builder{
+		name: Name,
+		newPickerBuilder: func() pickerBuilder {
+			return &rrPickerBuilder{connState: newConnState()}
+		},
+	}
 }
 
 func init() {
 	balancer.Register(newBuilder())
 }
 
-type rrPickerBuilder struct{}
+type rrPickerBuilder struct {
+	connState
+}
 
-func (*rrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+func (b *rrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	logger.Infof("roundrobinPicker: Build called with info: %v", info)
 	if len(info.ReadySCs) == 0 {
 		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
 	}
-	scs := make([]balancer.SubConn, 0, len(info.ReadySCs))
-	scm := make(map[string]balancer.SubConn)
-	for sc, info := range info.ReadySCs {
-		scs = append(scs, sc)
-		if id, ok := info.Address.Metadata.(string); ok {
-			scm[id] = sc
-		}
-	}
+	scs, scm := b.ready(info)
 	return &rrPicker{
+		pinner:   b.pinner(info, scm),
 		subConns: scs,
-		subConnm: scm,
 		// Start at a random index, as the same RR balancer rebuilds a new
 		// picker when SubConn states change, and we don't want to apply excess
 		// load to the first server in the list.
@@ -72,24 +72,21 @@ func (*rrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 type rrPicker struct {
 	// subConns is the snapshot of the roundrobin balancer when this picker was
 	// created. The slice is immutable. Each Get() will do a round robin
-	// selection from it and return the selected SubConn.
+	// selection from it and return the selected SubConn. Draining SubConns
+	// are excluded but still reachable through ServiceID.
+	pinner
 	subConns []balancer.SubConn
-	subConnm map[string]balancer.SubConn
 	next     uint32
 }
 
 func (p *rrPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
-	if id, ok := pi.Ctx.Value(ServiceID).(string); ok {
-		if sc, ok := p.subConnm[id]; ok {
-			return balancer.PickResult{SubConn: sc}, nil
-		}
+	if res, ok, err := p.pin(pi); ok {
+		return res, err
 	}
 
-	subConnsLen := uint32(len(p.subConns))
+	// 跳过被驱逐的实例，超过限流时按配置选择下一个实例
 	nextIndex := atomic.AddUint32(&p.next, 1)
-
-	sc := p.subConns[nextIndex%subConnsLen]
-	return balancer.PickResult{SubConn: sc}, nil
+	return p.choose(rotate(p.subConns, nextIndex))
 }
 
 type ck string
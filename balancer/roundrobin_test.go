@@ -0,0 +1,85 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/panshiqu/golang/discovery"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const rrConfig = `{"custom_round_robin":{}}`
+
+func TestRoundRobinDistribution(t *testing.T) {
+	h := newHarness(t, rrConfig, 3)
+	h.await(1, 2, 3)
+
+	dist := h.distribution(context.Background(), 300)
+	for id := 1; id <= 3; id++ {
+		if dist[id] != 100 {
+			t.Fatalf("distribution %v", dist)
+		}
+	}
+}
+
+func TestRoundRobinPin(t *testing.T) {
+	h := newHarness(t, rrConfig, 3)
+	h.await(1, 2, 3)
+
+	for range 10 {
+		if id, err := h.pin(context.Background(), 2); err != nil || id != 2 {
+			t.Fatalf("pin %d %v", id, err)
+		}
+	}
+
+	// 默认回退轮询
+	if _, err := h.pin(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), PinMiss, PinMissFail)
+	if _, err := h.pin(ctx, 4); status.Code(err) != codes.Unavailable {
+		t.Fatalf("pin miss fail %v", err)
+	}
+
+	// 等待实例就绪
+	ch := make(chan int)
+	go func() {
+		id, _ := h.pin(context.WithValue(context.Background(), PinMiss, PinMissWait), 4)
+		ch <- id
+	}()
+	select {
+	case id := <-ch:
+		t.Fatalf("pin miss wait returned %d", id)
+	case <-time.After(100 * time.Millisecond):
+	}
+	h.add(4, discovery.Metadata{ID: 4})
+	if id := <-ch; id != 4 {
+		t.Fatalf("pin miss wait %d", id)
+	}
+}
+
+func TestRoundRobinDrain(t *testing.T) {
+	h := newHarness(t, rrConfig, 3)
+	h.await(1, 2, 3)
+
+	h.update(2, func(md *discovery.Metadata) { md.Draining = true })
+	h.await(1, 3)
+
+	if id, err := h.pin(context.Background(), 2); err != nil || id != 2 {
+		t.Fatalf("pin draining %d %v", id, err)
+	}
+}
+
+func TestRoundRobinFailover(t *testing.T) {
+	h := newHarness(t, rrConfig, 3)
+	h.await(1, 2, 3)
+
+	h.stop(2)
+	h.await(1, 3)
+
+	h.remove(3)
+	h.await(1)
+}
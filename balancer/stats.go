@@ -0,0 +1,280 @@
+package balancer
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// AddrStats 单个实例的统计
+type AddrStats struct {
+	Picks    uint64
+	InFlight int64
+	Failures uint64
+
+	// Latency 平均调用耗时
+	Latency time.Duration
+}
+
+// StatsSnapshot 同一目标所有连接的统计
+type StatsSnapshot struct {
+	PinHits   uint64
+	PinMisses uint64
+
+	// Fallbacks 未命中后按 PinMissFallback 轮询的次数
+	Fallbacks uint64
+
+	Addrs map[string]AddrStats // 地址 -> 统计
+}
+
+// CallInfo 调用结束时传给 SetMetricsHook 设置的回调
+type CallInfo struct {
+	Target  string
+	Addr    string
+	Latency time.Duration
+	Err     error
+}
+
+var hook atomic.Pointer[func(CallInfo)]
+
+// SetMetricsHook 设置调用结束时的回调，在调用方协程执行，不应阻塞
+func SetMetricsHook(fn func(CallInfo)) {
+	hook.Store(&fn)
+}
+
+var (
+	statsMu sync.Mutex
+	targets = make(map[string]*stats) // 目标 -> 统计，最后一个连接关闭时删除
+)
+
+// Snapshot 按目标查询统计，例如 "discovery://127.0.0.1:2379/game"
+func Snapshot(target string) (StatsSnapshot, bool) {
+	statsMu.Lock()
+	s, ok := targets[target]
+	statsMu.Unlock()
+	if !ok {
+		return StatsSnapshot{}, false
+	}
+
+	return s.snapshot(), true
+}
+
+// getStats 每个连接调用一次，关闭时调用 putStats
+func getStats(target string) *stats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	s, ok := targets[target]
+	if !ok {
+		s = &stats{
+			target: target,
+			addrs:  make(map[string]*addrStats),
+		}
+		targets[target] = s
+	}
+	s.refs++
+	return s
+}
+
+func putStats(s *stats) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if s.refs--; s.refs == 0 {
+		delete(targets, s.target)
+	}
+}
+
+type addrStats struct {
+	picks    uint64
+	inflight int64
+	calls    uint64
+	failures uint64
+	latency  time.Duration // 累计耗时
+}
+
+type stats struct {
+	target string
+	refs   int // 使用中的连接数，由 statsMu 保护
+
+	m         sync.Mutex
+	pinHits   uint64
+	pinMisses uint64
+	fallbacks uint64
+	addrs     map[string]*addrStats
+}
+
+func (s *stats) snapshot() StatsSnapshot {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	ss := StatsSnapshot{
+		PinHits:   s.pinHits,
+		PinMisses: s.pinMisses,
+		Fallbacks: s.fallbacks,
+		Addrs:     make(map[string]AddrStats, len(s.addrs)),
+	}
+	for addr, v := range s.addrs {
+		as := AddrStats{
+			Picks:    v.picks,
+			InFlight: v.inflight,
+			Failures: v.failures,
+		}
+		if v.calls > 0 {
+			as.Latency = v.latency / time.Duration(v.calls)
+		}
+		ss.Addrs[addr] = as
+	}
+	return ss
+}
+
+// update 地址更新时移除已下线实例的统计
+func (s *stats) update(addrs map[string]bool) {
+	if s == nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for addr := range s.addrs {
+		if !addrs[addr] {
+			delete(s.addrs, addr)
+		}
+	}
+}
+
+// pin 记录 ServiceID 是否命中，未命中时是否回退轮询
+func (s *stats) pin(hit bool, fallback bool) {
+	if s == nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch {
+	case hit:
+		s.pinHits++
+	case fallback:
+		s.pinMisses++
+		s.fallbacks++
+	default:
+		s.pinMisses++
+	}
+}
+
+func (s *stats) pick(addr string) func(balancer.DoneInfo) {
+	s.m.Lock()
+	v, ok := s.addrs[addr]
+	if !ok {
+		v = &addrStats{}
+		s.addrs[addr] = v
+	}
+	v.picks++
+	v.inflight++
+	s.m.Unlock()
+
+	start := time.Now()
+	return func(info balancer.DoneInfo) {
+		d := time.Since(start)
+
+		s.m.Lock()
+		v.inflight--
+		v.calls++
+		v.latency += d
+		if info.Err != nil {
+			v.failures++
+		}
+		s.m.Unlock()
+
+		if fn := hook.Load(); fn != nil && *fn != nil {
+			(*fn)(CallInfo{Target: s.target, Addr: addr, Latency: d, Err: info.Err})
+		}
+	}
+}
+
+// statsClientConn 记录 SubConn 的地址，包装生成的 picker，SubConn 状态回调时加锁
+type statsClientConn struct {
+	balancer.ClientConn
+	stats  *stats
+	locker sync.Locker
+
+	m        sync.Mutex
+	subConns map[balancer.SubConn]string
+}
+
+func (cc *statsClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	var sc balancer.SubConn
+	listener := opts.StateListener
+	opts.StateListener = func(s balancer.SubConnState) {
+		if s.ConnectivityState == connectivity.Shutdown {
+			cc.m.Lock()
+			delete(cc.subConns, sc)
+			cc.m.Unlock()
+		}
+		if listener != nil {
+			cc.locker.Lock()
+			listener(s)
+			cc.locker.Unlock()
+		}
+	}
+
+	sc, err := cc.ClientConn.NewSubConn(addrs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) > 0 {
+		cc.m.Lock()
+		cc.subConns[sc] = addrs[0].Addr
+		cc.m.Unlock()
+	}
+	return sc, nil
+}
+
+func (cc *statsClientConn) UpdateState(s balancer.State) {
+	cc.m.Lock()
+	subConns := maps.Clone(cc.subConns)
+	cc.m.Unlock()
+
+	s.Picker = &statsPicker{
+		Picker:   s.Picker,
+		stats:    cc.stats,
+		subConns: subConns,
+	}
+	cc.ClientConn.UpdateState(s)
+}
+
+type statsPicker struct {
+	balancer.Picker
+	stats    *stats
+	subConns map[balancer.SubConn]string
+}
+
+func (p *statsPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	res, err := p.Picker.Pick(pi)
+	if err != nil {
+		return res, err
+	}
+
+	addr, ok := p.subConns[res.SubConn]
+	if !ok {
+		return res, nil
+	}
+
+	record := p.stats.pick(addr)
+	done := res.Done
+	res.Done = func(info balancer.DoneInfo) {
+		record(info)
+		if done != nil {
+			done(info)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStatsRelease(t *testing.T) {
+	h := newHarness(t, rrConfig, 3)
+	h.await(1, 2, 3)
+
+	target := h.cc.Target()
+	if ss, ok := Snapshot(target); !ok || len(ss.Addrs) != 3 {
+		t.Fatalf("snapshot %v %v", ss, ok)
+	}
+
+	// 已下线实例的统计被移除
+	h.remove(3)
+	h.await(1, 2)
+	if ss, _ := Snapshot(target); len(ss.Addrs) != 2 {
+		t.Fatalf("after remove %v", ss)
+	}
+
+	// 最后一个连接关闭后移除目标
+	h.distribution(context.Background(), 10)
+	h.cc.Close()
+	if _, ok := Snapshot(target); ok {
+		t.Fatal("snapshot after close")
+	}
+}
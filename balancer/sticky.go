@@ -0,0 +1,153 @@
+package balancer
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// StickySession 首次调用轮询，之后固定到首次选择的实例，实例不可用时按 PinMissPolicy 处理，
+// 回退轮询后固定到新的实例
+type StickySession struct {
+	m  sync.Mutex
+	id string
+}
+
+func NewStickySession() *StickySession {
+	return &StickySession{}
+}
+
+// ID 固定的 ServiceID，尚未调用时为空
+func (s *StickySession) ID() string {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.id
+}
+
+// Reset 下次调用重新轮询
+func (s *StickySession) Reset() {
+	s.set("")
+}
+
+func (s *StickySession) set(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.id = id
+}
+
+type stickyKey struct{}
+
+// WithStickySession 同一个会话的调用使用相同的上下文值
+func WithStickySession(ctx context.Context, s *StickySession) context.Context {
+	return context.WithValue(ctx, stickyKey{}, s)
+}
+
+// StickyUnaryClientInterceptor 会话已固定时设置 ServiceID，记录 picker 选择的实例id
+func StickyUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		s, ok := ctx.Value(stickyKey{}).(*StickySession)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		p := &stickyPick{}
+		err := invoker(s.context(ctx, p), method, req, reply, cc, opts...)
+		s.record(p)
+		return err
+	}
+}
+
+// StickyStreamClientInterceptor 创建流时已经选择实例，创建后记录
+func StickyStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		s, ok := ctx.Value(stickyKey{}).(*StickySession)
+		if !ok {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		p := &stickyPick{}
+		cs, err := streamer(s.context(ctx, p), desc, cc, method, opts...)
+		s.record(p)
+		return cs, err
+	}
+}
+
+// context 已固定且未指定 ServiceID 时设置，并传递记录选择结果的 stickyPick
+func (s *StickySession) context(ctx context.Context, p *stickyPick) context.Context {
+	ctx = context.WithValue(ctx, stickyPickKey{}, p)
+	if _, ok := ctx.Value(ServiceID).(string); ok {
+		return ctx
+	}
+	if id := s.ID(); id != "" {
+		return context.WithValue(ctx, ServiceID, id)
+	}
+	return ctx
+}
+
+// record 重试时以最后一次选择为准，没有选择实例时保持不变
+func (s *StickySession) record(p *stickyPick) {
+	if id := p.load(); id != "" {
+		s.set(id)
+	}
+}
+
+type stickyPickKey struct{}
+
+// stickyPick 每次调用一个，picker 选择实例后写入实例id
+type stickyPick struct {
+	m  sync.Mutex
+	id string
+}
+
+func (p *stickyPick) store(id string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.id = id
+}
+
+func (p *stickyPick) load() string {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.id
+}
+
+// stickyPickerBuilder 包装各 pickerBuilder 生成的 picker，按 SubConn 查找实例id
+type stickyPickerBuilder struct {
+	pickerBuilder
+}
+
+func (b *stickyPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	ids := make(map[balancer.SubConn]string, len(info.ReadySCs))
+	for sc, info := range info.ReadySCs {
+		if id, ok := b.state().serviceID(info.Address); ok {
+			ids[sc] = id
+		}
+	}
+	return &stickyPicker{Picker: b.pickerBuilder.Build(info), ids: ids}
+}
+
+type stickyPicker struct {
+	balancer.Picker
+	ids map[balancer.SubConn]string
+}
+
+func (p *stickyPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	res, err := p.Picker.Pick(pi)
+	if err != nil {
+		return res, err
+	}
+
+	if sp, ok := pi.Ctx.Value(stickyPickKey{}).(*stickyPick); ok {
+		if id, ok := p.ids[res.SubConn]; ok {
+			sp.store(id)
+		}
+	}
+	return res, nil
+}
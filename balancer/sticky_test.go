@@ -0,0 +1,73 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+func TestStickySession(t *testing.T) {
+	h := newHarness(t, rrConfig, 3, grpc.WithUnaryInterceptor(StickyUnaryClientInterceptor()))
+	h.await(1, 2, 3)
+
+	s := NewStickySession()
+	ctx := WithStickySession(context.Background(), s)
+
+	first, err := h.call(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID() != strconv.Itoa(first) {
+		t.Fatalf("session id %q first %d", s.ID(), first)
+	}
+	for range 10 {
+		if id, err := h.call(ctx); err != nil || id != first {
+			t.Fatalf("sticky %d %v", id, err)
+		}
+	}
+
+	// 实例下线后回退轮询并固定到新的实例
+	h.remove(first)
+	second, err := h.call(ctx)
+	if err != nil || second == first {
+		t.Fatalf("failover %d %v", second, err)
+	}
+	for range 10 {
+		if id, err := h.call(ctx); err != nil || id != second {
+			t.Fatalf("sticky after failover %d %v", id, err)
+		}
+	}
+
+	s.Reset()
+	if s.ID() != "" {
+		t.Fatalf("reset %q", s.ID())
+	}
+}
+
+func TestStickySessionStream(t *testing.T) {
+	h := newHarness(t, rrConfig, 3, grpc.WithStreamInterceptor(StickyStreamClientInterceptor()))
+	h.await(1, 2, 3)
+
+	s := NewStickySession()
+	ctx := WithStickySession(context.Background(), s)
+
+	first, err := h.stream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID() != strconv.Itoa(first) {
+		t.Fatalf("session id %q first %d", s.ID(), first)
+	}
+	for range 10 {
+		if id, err := h.stream(ctx); err != nil || id != first {
+			t.Fatalf("sticky %d %v", id, err)
+		}
+	}
+
+	// 未使用会话的调用仍然轮询
+	if dist := h.distribution(context.Background(), 30); len(dist) != 3 {
+		t.Fatalf("round robin %v", dist)
+	}
+}
@@ -0,0 +1,163 @@
+package balancer
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// 按需连接的实例空闲超过后移出子集
+const subsetIdleTimeout = 5 * time.Minute
+
+// 按需连接的实例首次就绪前等待的最长时间，超过后按 PinMissPolicy 处理
+const subsetConnectTimeout = 20 * time.Second
+
+var clientID atomic.Int64
+
+func init() {
+	clientID.Store(rand.Int63())
+}
+
+// SetClientID 子集划分使用的客户端id，建议使用本进程注册时分配的id，
+// 连续的id划分最均匀，默认为随机值
+func SetClientID(id int) {
+	clientID.Store(int64(id))
+}
+
+// subset 确定性子集划分，同一轮的客户端打乱顺序相同，各取不同的段，
+// 子集外的实例被 ServiceID 指定时按需连接
+func subset(addrs []resolver.Address, size int, id int64) []resolver.Address {
+	if size <= 0 || len(addrs) <= size {
+		return addrs
+	}
+
+	addrs = slices.SortedFunc(slices.Values(addrs), func(a, b resolver.Address) int {
+		return cmp.Compare(a.Addr, b.Addr)
+	})
+
+	count := uint64(len(addrs) / size)
+	round := uint64(id) / count
+	rand.New(rand.NewSource(int64(round))).Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+
+	start := int(uint64(id)%count) * size
+	return addrs[start : start+size]
+}
+
+// subsetter 每个连接一个，记录按需连接的id
+type subsetter struct {
+	// refilter 使用最近的地址重新划分，不依赖 resolver 重新解析
+	refilter func()
+
+	m        sync.Mutex
+	known    map[string]bool      // 全部实例的id
+	included map[string]bool      // 子集内和按需连接的id
+	demand   map[string]time.Time // 按需连接的id -> 最近使用时间
+	pending  map[string]time.Time // 按需连接尚未就绪的id -> 请求时间
+	extra    map[string]bool      // 按需连接的地址，不参与轮询
+}
+
+func newSubsetter(refilter func()) *subsetter {
+	return &subsetter{
+		refilter: refilter,
+		known:    make(map[string]bool),
+		included: make(map[string]bool),
+		demand:   make(map[string]time.Time),
+		pending:  make(map[string]time.Time),
+		extra:    make(map[string]bool),
+	}
+}
+
+// filter 子集加上按需连接的实例
+func (s *subsetter) filter(addrs []resolver.Address, size int, serviceID func(resolver.Address) (string, bool)) []resolver.Address {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	clear(s.known)
+	clear(s.included)
+	clear(s.extra)
+	ids := make(map[string]resolver.Address, len(addrs))
+	for _, addr := range addrs {
+		if id, ok := serviceID(addr); ok {
+			s.known[id] = true
+			ids[id] = addr
+		}
+	}
+
+	filtered := subset(addrs, size, clientID.Load())
+	in := make(map[string]bool, len(filtered))
+	for _, addr := range filtered {
+		in[addr.Addr] = true
+	}
+
+	now := time.Now()
+	for id, used := range s.demand {
+		addr, ok := ids[id]
+		if !ok || now.Sub(used) > subsetIdleTimeout {
+			delete(s.demand, id)
+			delete(s.pending, id)
+			continue
+		}
+		if !in[addr.Addr] {
+			filtered = append(filtered, addr)
+			in[addr.Addr] = true
+			s.extra[addr.Addr] = true
+		}
+	}
+
+	for id, addr := range ids {
+		if in[addr.Addr] {
+			s.included[id] = true
+		}
+	}
+
+	return filtered
+}
+
+// want 子集外的id按需连接，返回true时等待连接就绪，不按 PinMissPolicy 处理
+func (s *subsetter) want(id string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.known[id] {
+		return false
+	}
+
+	now := time.Now()
+	if !s.included[id] {
+		if _, ok := s.demand[id]; !ok {
+			s.pending[id] = now
+			go s.refilter()
+		}
+		s.demand[id] = now
+		return true
+	}
+
+	// 已加入子集，首次连接超时前继续等待
+	requested, ok := s.pending[id]
+	return ok && now.Sub(requested) < subsetConnectTimeout
+}
+
+// used 按需连接的id保持在子集中
+func (s *subsetter) used(id string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.pending, id)
+	if _, ok := s.demand[id]; ok {
+		s.demand[id] = time.Now()
+	}
+}
+
+func (s *subsetter) isExtra(addr string) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.extra[addr]
+}
@@ -0,0 +1,37 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSubsetPin(t *testing.T) {
+	h := newHarness(t, `{"custom_round_robin":{"subsetSize":2}}`, 5)
+
+	// 等待子集内的实例都就绪
+	var dist map[int]int
+	for deadline := time.Now().Add(5 * time.Second); len(dist) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("subset %v", dist)
+		}
+		dist = h.distribution(context.Background(), 10)
+	}
+	if len(dist) != 2 {
+		t.Fatalf("subset %v", dist)
+	}
+
+	// 子集外的实例首次调用即按需连接，不回退轮询
+	for id := 1; id <= 5; id++ {
+		if got, err := h.pin(context.Background(), id); err != nil || got != id {
+			t.Fatalf("pin %d got %d %v", id, got, err)
+		}
+	}
+
+	// 按需连接的实例不参与轮询
+	for id := range h.distribution(context.Background(), 20) {
+		if dist[id] == 0 {
+			t.Fatalf("round robin to on demand %d", id)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package balancer
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// WeightedName 平滑加权轮询，权重取自发现元数据的 Weight
+const WeightedName = "custom_weighted_round_robin"
+
+func newWeightedBuilder() balancer.Builder {
+	return &builder{
+		name: WeightedName,
+		newPickerBuilder: func() pickerBuilder {
+			return &wrrPickerBuilder{connState: newConnState()}
+		},
+	}
+}
+
+func init() {
+	balancer.Register(newWeightedBuilder())
+}
+
+type wrrPickerBuilder struct {
+	connState
+}
+
+func (b *wrrPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	logger.Infof("weightedRoundrobinPicker: Build called with info: %v", info)
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	scs, scm := b.ready(info)
+	p := &wrrPicker{
+		pinner:   b.pinner(info, scm),
+		subConns: make([]*weightedSubConn, 0, len(scs)),
+	}
+	for _, sc := range scs {
+		p.subConns = append(p.subConns, &weightedSubConn{
+			SubConn: sc,
+			weight:  b.weight(info.ReadySCs[sc].Address),
+		})
+	}
+	return p
+}
+
+type weightedSubConn struct {
+	balancer.SubConn
+	weight  int
+	current int
+}
+
+// wrrPicker 同nginx的平滑加权轮询，权重 5,1,1 时依次选择 a,a,b,a,c,a,a
+type wrrPicker struct {
+	pinner
+
+	m        sync.Mutex
+	subConns []*weightedSubConn
+}
+
+func (p *wrrPicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	if res, ok, err := p.pin(pi); ok {
+		return res, err
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	// 被驱逐的实例不参与加权，全部被驱逐时仍然参与
+	var best *weightedSubConn
+	var bestIndex, total int
+	for _, ejected := range []bool{false, true} {
+		for i, sc := range p.subConns {
+			if !ejected && p.ejected(sc.SubConn) {
+				continue
+			}
+			sc.current += sc.weight
+			total += sc.weight
+			if best == nil || sc.current > best.current {
+				best, bestIndex = sc, i
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	best.current -= total
+
+	// 超过限流时按配置选择下一个实例
+	return p.choose(func(yield func(balancer.SubConn) bool) {
+		for i := range len(p.subConns) {
+			if !yield(p.subConns[(bestIndex+i)%len(p.subConns)].SubConn) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package balancer
+
+import (
+	"context"
+	"iter"
+	"math/rand"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// ZoneConfig 可用区和灰度配置，取自发现元数据的 Zone 和 Version
+type ZoneConfig struct {
+	// Zone 调用方所在可用区，为空时不区分
+	Zone string
+
+	// CanaryVersion 灰度版本，为空时不灰度
+	CanaryVersion string
+
+	// CanaryPercent 进入灰度的调用百分比，有 HashKey 时同一个键结果一致
+	CanaryPercent int
+}
+
+// NewZoneBuilder 优先轮询本可用区的实例，本可用区没有就绪实例时才使用其它可用区，
+// 需以 balancer.Register 注册
+func NewZoneBuilder(name string, cfg ZoneConfig) balancer.Builder {
+	return &builder{
+		name: name,
+		newPickerBuilder: func() pickerBuilder {
+			return &zonePickerBuilder{connState: newConnState(), cfg: cfg}
+		},
+	}
+}
+
+// Canary 单次调用是否进入灰度，优先于 CanaryPercent
+const Canary = ck("Canary")
+
+type zonePickerBuilder struct {
+	connState
+	cfg ZoneConfig
+}
+
+func (b *zonePickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	logger.Infof("zonePicker: Build called with info: %v", info)
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	scs, scm := b.ready(info)
+	p := &zonePicker{
+		pinner:  b.pinner(info, scm),
+		percent: b.cfg.CanaryPercent,
+		next:    uint32(rand.Intn(len(scs))),
+	}
+	for _, sc := range scs {
+		var zone, version string
+		if md, ok := b.md.get(info.ReadySCs[sc].Address); ok {
+			zone, version = md.Zone, md.Version
+		}
+		g := &p.stable
+		if b.cfg.CanaryVersion != "" && version == b.cfg.CanaryVersion {
+			g = &p.canary
+		}
+		if b.cfg.Zone == "" || zone == b.cfg.Zone {
+			g.local = append(g.local, sc)
+		} else {
+			g.remote = append(g.remote, sc)
+		}
+	}
+	return p
+}
+
+type zoneGroup struct {
+	local  []balancer.SubConn
+	remote []balancer.SubConn
+}
+
+// candidates 优先本可用区，本可用区的实例都被驱逐或超过限流时使用其它可用区
+func (g *zoneGroup) candidates(start uint32) iter.Seq[balancer.SubConn] {
+	return func(yield func(balancer.SubConn) bool) {
+		for sc := range rotate(g.local, start) {
+			if !yield(sc) {
+				return
+			}
+		}
+		for sc := range rotate(g.remote, start) {
+			if !yield(sc) {
+				return
+			}
+		}
+	}
+}
+
+type zonePicker struct {
+	pinner
+	stable  zoneGroup
+	canary  zoneGroup
+	percent int
+	next    uint32
+}
+
+func (p *zonePicker) Pick(pi balancer.PickInfo) (balancer.PickResult, error) {
+	if res, ok, err := p.pin(pi); ok {
+		return res, err
+	}
+
+	g := &p.stable
+	if len(p.canary.local)+len(p.canary.remote) > 0 && (len(g.local)+len(g.remote) == 0 || p.isCanary(pi.Ctx)) {
+		g = &p.canary
+	}
+
+	nextIndex := atomic.AddUint32(&p.next, 1)
+	return p.choose(g.candidates(nextIndex))
+}
+
+func (p *zonePicker) isCanary(ctx context.Context) bool {
+	if v, ok := ctx.Value(Canary).(bool); ok {
+		return v
+	}
+	if p.percent <= 0 {
+		return false
+	}
+	if key, ok := ctx.Value(HashKey).(string); ok {
+		return hash(key)%100 < uint64(p.percent)
+	}
+	return rand.Intn(100) < p.percent
+}
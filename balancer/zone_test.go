@@ -0,0 +1,151 @@
+package balancer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/panshiqu/golang/discovery"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// zoneInfo 本可用区 l1、l2，其它可用区 r1，本可用区的灰度实例 c1
+func zoneInfo() base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo)}
+	for i, md := range []struct{ addr, zone, version string }{
+		{"l1", "z1", "v1"},
+		{"l2", "z1", "v1"},
+		{"r1", "z2", "v1"},
+		{"c1", "z1", "v2"},
+	} {
+		addr := discovery.SetMetadata(resolver.Address{Addr: md.addr}, &discovery.Metadata{ID: i + 1, Zone: md.zone, Version: md.version})
+		info.ReadySCs[&fakeSubConn{addr: md.addr}] = base.SubConnInfo{Address: addr}
+	}
+	return info
+}
+
+// zoneBuilder 本可用区 z1，灰度版本 v2 占 30%
+func zoneBuilder() pickerBuilder {
+	return NewZoneBuilder("zone", ZoneConfig{Zone: "z1", CanaryVersion: "v2", CanaryPercent: 30}).(*builder).newPickerBuilder()
+}
+
+// zonePicks n 次调用选择的实例地址
+func zonePicks(t *testing.T, p balancer.Picker, ctx context.Context, n int) map[string]int {
+	t.Helper()
+
+	picks := make(map[string]int)
+	for range n {
+		res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+		if err != nil {
+			t.Fatal(err)
+		}
+		picks[res.SubConn.(*fakeSubConn).addr]++
+	}
+	return picks
+}
+
+func TestZoneLocal(t *testing.T) {
+	pb := zoneBuilder()
+	p := pb.Build(zoneInfo())
+
+	ctx := context.WithValue(context.Background(), Canary, false)
+	if picks := zonePicks(t, p, ctx, 20); len(picks) != 2 || picks["l1"] != 10 || picks["l2"] != 10 {
+		t.Fatalf("local %v", picks)
+	}
+}
+
+func TestZoneEjected(t *testing.T) {
+	pb := zoneBuilder()
+
+	cfg := &outlierConfig{ConsecutiveFailures: 1, MaxEjectedPercent: 100}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	od := newOutlierDetector(cfg)
+	od.update(map[string]bool{"l1": true, "l2": true, "r1": true, "c1": true})
+	pb.state().od = od
+	p := pb.Build(zoneInfo())
+
+	// 本可用区部分驱逐时仍然使用本可用区
+	od.done("l1")(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "")})
+	ctx := context.WithValue(context.Background(), Canary, false)
+	if picks := zonePicks(t, p, ctx, 10); len(picks) != 1 || picks["l2"] != 10 {
+		t.Fatalf("partly ejected %v", picks)
+	}
+
+	// 全部驱逐时使用其它可用区
+	od.done("l2")(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "")})
+	if picks := zonePicks(t, p, ctx, 10); len(picks) != 1 || picks["r1"] != 10 {
+		t.Fatalf("ejected %v", picks)
+	}
+}
+
+func TestZoneLimited(t *testing.T) {
+	for _, onLimit := range []limitPolicy{limitReject, limitNext} {
+		pb := zoneBuilder()
+
+		cfg := &limitConfig{QPS: 0.01, Burst: 1, OnLimit: onLimit}
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		lim := newLimiter(cfg)
+		lim.update(map[string]bool{"l1": true, "l2": true, "r1": true, "c1": true})
+		pb.state().lim = lim
+		p := pb.Build(zoneInfo())
+
+		for _, addr := range []string{"l1", "l2"} {
+			if _, ok := lim.acquire(addr); !ok {
+				t.Fatalf("acquire %s", addr)
+			}
+		}
+
+		ctx := context.WithValue(context.Background(), Canary, false)
+		res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+		switch onLimit {
+		case limitReject:
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("reject %v", err)
+			}
+		case limitNext:
+			if err != nil || res.SubConn.(*fakeSubConn).addr != "r1" {
+				t.Fatalf("next %v %v", res.SubConn, err)
+			}
+		}
+	}
+}
+
+func TestZoneCanary(t *testing.T) {
+	pb := zoneBuilder()
+	p := pb.Build(zoneInfo())
+
+	// 同一个 HashKey 结果一致，比例接近 CanaryPercent
+	canary := 0
+	for i := range 1000 {
+		ctx := context.WithValue(context.Background(), HashKey, strconv.Itoa(i))
+		picks := zonePicks(t, p, ctx, 4)
+		if picks["c1"] != 0 && picks["c1"] != 4 {
+			t.Fatalf("key %d unstable %v", i, picks)
+		}
+		if picks["c1"] == 4 {
+			canary++
+		}
+	}
+	if canary < 200 || canary > 400 {
+		t.Fatalf("canary %d/1000", canary)
+	}
+
+	// Canary 优先于 CanaryPercent
+	for i := range 100 {
+		ctx := context.WithValue(context.Background(), HashKey, strconv.Itoa(i))
+		if picks := zonePicks(t, p, context.WithValue(ctx, Canary, true), 2); picks["c1"] != 2 {
+			t.Fatalf("canary override %v", picks)
+		}
+		if picks := zonePicks(t, p, context.WithValue(ctx, Canary, false), 2); picks["c1"] != 0 {
+			t.Fatalf("stable override %v", picks)
+		}
+	}
+}
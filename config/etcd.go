@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/panshiqu/golang/discovery"
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrNotFound 配置键不存在
+var ErrNotFound = errors.New("config not found")
+
+// Config 从etcd键 config/<key> 读取JSON配置并监听更新
+type Config[T any] struct {
+	cli   *clientv3.Client
+	owned bool
+	key   string
+
+	validate func(*T) error
+
+	v   atomic.Pointer[T]
+	rev int64 // 当前配置的修改版本
+
+	m   sync.Mutex
+	fns []func(old, new *T)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New 返回时已加载配置，validate可为nil，连接选项同 discovery
+func New[T any](ctx context.Context, key string, validate func(*T) error, opts ...discovery.Option) (*Config[T], error) {
+	cli, owned, err := discovery.NewClient(opts...)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := &Config[T]{
+		cli:      cli,
+		owned:    owned,
+		key:      discovery.Key("config/"+key, opts...),
+		validate: validate,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	rev, err := c.load()
+	if err != nil {
+		cancel()
+		if owned {
+			logger.Error(cli.Close(), slog.Default(), "close")
+		}
+		return nil, utils.Wrap(err)
+	}
+
+	go c.watch(rev)
+
+	return c, nil
+}
+
+// Load 当前配置，不要修改
+func (c *Config[T]) Load() *T {
+	return c.v.Load()
+}
+
+// OnChange 配置更新且校验通过后按注册顺序回调
+func (c *Config[T]) OnChange(fn func(old, new *T)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.fns = append(c.fns, fn)
+}
+
+// Save 校验后写入etcd，各实例通过监听更新
+func (c *Config[T]) Save(ctx context.Context, v *T) error {
+	if c.validate != nil {
+		if err := c.validate(v); err != nil {
+			return utils.Wrap(err)
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return utils.Wrap(err)
+	}
+
+	if _, err := c.cli.Put(ctx, c.key, string(data)); err != nil {
+		return utils.Wrap(err)
+	}
+
+	return nil
+}
+
+func (c *Config[T]) Close() error {
+	c.cancel()
+	<-c.done
+
+	if c.owned {
+		return utils.Wrap(c.cli.Close())
+	}
+	return nil
+}
+
+// load 加载并返回当前版本
+func (c *Config[T]) load() (int64, error) {
+	resp, err := c.cli.Get(c.ctx, c.key)
+	if err != nil {
+		return 0, utils.Wrap(err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return 0, utils.Wrap(fmt.Errorf("%w: %s", ErrNotFound, c.key))
+	}
+
+	if err := c.set(resp.Kvs[0]); err != nil {
+		return 0, utils.Wrap(err)
+	}
+
+	return resp.Header.Revision, nil
+}
+
+// set 解析校验通过后替换并回调，重新加载未修改的配置时忽略
+func (c *Config[T]) set(kv *mvccpb.KeyValue) error {
+	if kv.ModRevision == c.rev {
+		return nil
+	}
+
+	v := new(T)
+	if err := json.Unmarshal(kv.Value, v); err != nil {
+		return utils.Wrap(err)
+	}
+
+	if c.validate != nil {
+		if err := c.validate(v); err != nil {
+			return utils.Wrap(err)
+		}
+	}
+
+	c.rev = kv.ModRevision
+
+	old := c.v.Swap(v)
+	if old == nil {
+		return nil
+	}
+
+	c.m.Lock()
+	fns := c.fns
+	c.m.Unlock()
+
+	for _, fn := range fns {
+		fn(old, v)
+	}
+
+	return nil
+}
+
+// watch 监听更新，压缩或断开时重新加载，无效的配置被忽略
+func (c *Config[T]) watch(rev int64) {
+	defer close(c.done)
+
+	for c.ctx.Err() == nil {
+		if rev == 0 {
+			var err error
+			if rev, err = c.load(); err != nil {
+				if c.ctx.Err() != nil {
+					return
+				}
+
+				slog.Error("config load", slog.String("key", c.key), slog.Any("err", err))
+
+				select {
+				case <-time.After(discovery.ReloadDelay):
+				case <-c.ctx.Done():
+				}
+				continue
+			}
+		}
+
+		wch := c.cli.Watch(clientv3.WithRequireLeader(c.ctx), c.key, clientv3.WithRev(rev+1))
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				slog.Warn("config watch", slog.String("key", c.key), slog.Any("err", err))
+				break
+			}
+
+			for _, ev := range resp.Events {
+				switch ev.Type {
+				case clientv3.EventTypePut:
+					if err := c.set(ev.Kv); err != nil {
+						slog.Error("config update", slog.String("key", c.key), slog.Any("err", err))
+						continue
+					}
+					slog.Info("config update", slog.String("key", c.key), slog.Int64("rev", ev.Kv.ModRevision))
+				case clientv3.EventTypeDelete:
+					slog.Warn("config delete", slog.String("key", c.key))
+				}
+			}
+		}
+
+		rev = 0
+	}
+}
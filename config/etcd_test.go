@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/panshiqu/golang/discovery"
+)
+
+// etcdOptions 需要etcd，例如 ETCD_ENDPOINTS=127.0.0.1:2379，每个测试使用独立前缀
+func etcdOptions(t *testing.T) []discovery.Option {
+	t.Helper()
+
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+
+	return []discovery.Option{
+		discovery.WithEndpoints(strings.Split(endpoints, ",")...),
+		discovery.WithPrefix("test/" + t.Name() + "/" + time.Now().Format("150405.000000000")),
+	}
+}
+
+type gameConfig struct {
+	MaxPlayers int `json:"max_players"`
+}
+
+func validate(c *gameConfig) error {
+	if c.MaxPlayers <= 0 {
+		return errors.New("invalid max players")
+	}
+	return nil
+}
+
+func TestConfig(t *testing.T) {
+	opts := etcdOptions(t)
+
+	cli, _, err := discovery.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	opts = append(opts, discovery.WithClient(cli))
+
+	if _, err := New(context.Background(), "game", validate, opts...); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("not found %v", err)
+	}
+
+	key := discovery.Key("config/game", opts...)
+	if _, err := cli.Put(context.Background(), key, `{"max_players": 4}`); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(context.Background(), "game", validate, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v := c.Load(); v.MaxPlayers != 4 {
+		t.Fatalf("load %v", v)
+	}
+
+	ch := make(chan [2]int, 4)
+	c.OnChange(func(old, new *gameConfig) {
+		ch <- [2]int{old.MaxPlayers, new.MaxPlayers}
+	})
+
+	// 校验失败时拒绝保存，直接写入的无效配置被忽略
+	if err := c.Save(context.Background(), &gameConfig{}); err == nil {
+		t.Fatal("save invalid")
+	}
+	if _, err := cli.Put(context.Background(), key, `{"max_players": -1}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Save(context.Background(), &gameConfig{MaxPlayers: 8}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-ch:
+		if v != [2]int{4, 8} {
+			t.Fatalf("change %v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change timeout")
+	}
+	if v := c.Load(); v.MaxPlayers != 8 {
+		t.Fatalf("load after change %v", v)
+	}
+}
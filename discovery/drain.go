@@ -0,0 +1,38 @@
+package discovery
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/panshiqu/golang/utils"
+)
+
+// 排空期间检查是否空闲的间隔
+const drainCheckInterval = time.Second
+
+// Drain 标记为排空，负载均衡不再轮询到本实例，指定ServiceID的调用不受影响，
+// 超过grace或idle返回true后释放，idle可为nil
+func (s *Service) Drain(grace time.Duration, idle func() bool) error {
+	slog.Info("drain", slog.String("key", s.key), slog.String("addr", s.addr), slog.Duration("grace", grace))
+
+	if err := s.update(func(md *Metadata) { md.Draining = true }); err != nil {
+		return utils.Wrap(err)
+	}
+
+	deadline := time.After(grace)
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for idle == nil || !idle() {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return utils.Wrap(s.Release())
+		case <-s.session.ctx.Done():
+			return utils.Wrap(s.Release())
+		}
+	}
+
+	return utils.Wrap(s.Release())
+}
@@ -0,0 +1,192 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// concurrencySession 选举和锁共用，租约过期后 Done 关闭
+type concurrencySession struct {
+	cli     *clientv3.Client
+	owned   bool
+	session *concurrency.Session
+}
+
+func newConcurrencySession(o *options) (*concurrencySession, error) {
+	cli, owned, err := o.client()
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	s, err := concurrency.NewSession(cli, concurrency.WithTTL(int(o.ttl)), concurrency.WithContext(o.ctx))
+	if err != nil {
+		if owned {
+			logger.Error(cli.Close(), slog.Default(), "close")
+		}
+		return nil, utils.Wrap(err)
+	}
+
+	return &concurrencySession{
+		cli:     cli,
+		owned:   owned,
+		session: s,
+	}, nil
+}
+
+// Done 租约过期或关闭时关闭，此后需重新创建
+func (s *concurrencySession) Done() <-chan struct{} {
+	return s.session.Done()
+}
+
+func (s *concurrencySession) Close() error {
+	select {
+	case <-s.session.Done():
+		// 租约已过期，无需撤销
+		s.session.Orphan()
+	default:
+		if err := s.session.Close(); err != nil {
+			slog.Error("session close", slog.Any("err", err))
+		}
+	}
+
+	if s.owned {
+		return utils.Wrap(s.cli.Close())
+	}
+	return nil
+}
+
+// Election 选举，键为 election/<key>
+type Election struct {
+	*concurrencySession
+
+	key      string
+	val      string
+	election *concurrency.Election
+}
+
+// NewElection 以 addr 和 id 作为候选人
+func NewElection(key string, addr string, id int, opts ...Option) (*Election, error) {
+	o := newOptions(opts...)
+
+	val, err := encode(addr, &Metadata{ID: id, StartTime: time.Now()})
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	s, err := newConcurrencySession(o)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	return &Election{
+		concurrencySession: s,
+		key:                key,
+		val:                val,
+		election:           concurrency.NewElection(s.session, o.path("election", key)),
+	}, nil
+}
+
+// Campaign 阻塞直到当选或ctx结束，当选后通过 Done 感知租约过期失去领导权
+func (e *Election) Campaign(ctx context.Context) error {
+	if err := e.election.Campaign(ctx, e.val); err != nil {
+		return utils.Wrap(err)
+	}
+
+	slog.Info("elected", slog.String("key", e.key), slog.String("val", e.val))
+
+	return nil
+}
+
+// Resign 主动放弃领导权
+func (e *Election) Resign(ctx context.Context) error {
+	return utils.Wrap(e.election.Resign(ctx))
+}
+
+// Leader 当前领导者，没有领导者时返回 concurrency.ErrElectionNoLeader
+func (e *Election) Leader(ctx context.Context) (Instance, error) {
+	resp, err := e.election.Leader(ctx)
+	if err != nil {
+		return Instance{}, utils.Wrap(err)
+	}
+
+	return e.instance(resp.Kvs[0].Value)
+}
+
+// Observe 领导者变化，ctx结束后关闭
+func (e *Election) Observe(ctx context.Context) <-chan Instance {
+	ch := make(chan Instance)
+
+	go func() {
+		defer close(ch)
+
+		for resp := range e.election.Observe(ctx) {
+			ins, err := e.instance(resp.Kvs[0].Value)
+			if err != nil {
+				slog.Error("observe", slog.String("key", e.key), slog.Any("err", err))
+				continue
+			}
+
+			select {
+			case ch <- ins:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (e *Election) instance(data []byte) (Instance, error) {
+	addr, md, err := decode(data)
+	if err != nil {
+		return Instance{}, utils.Wrap(err)
+	}
+
+	return Instance{
+		Key:      e.key,
+		Addr:     addr,
+		Metadata: md,
+	}, nil
+}
+
+// Mutex 分布式锁，键为 mutex/<key>
+type Mutex struct {
+	*concurrencySession
+
+	mutex *concurrency.Mutex
+}
+
+func NewMutex(key string, opts ...Option) (*Mutex, error) {
+	o := newOptions(opts...)
+
+	s, err := newConcurrencySession(o)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	return &Mutex{
+		concurrencySession: s,
+		mutex:              concurrency.NewMutex(s.session, o.path("mutex", key)),
+	}, nil
+}
+
+// Lock 阻塞直到加锁成功或ctx结束
+func (m *Mutex) Lock(ctx context.Context) error {
+	return utils.Wrap(m.mutex.Lock(ctx))
+}
+
+// TryLock 已被锁定时返回 concurrency.ErrLocked
+func (m *Mutex) TryLock(ctx context.Context) error {
+	return utils.Wrap(m.mutex.TryLock(ctx))
+}
+
+func (m *Mutex) Unlock(ctx context.Context) error {
+	return utils.Wrap(m.mutex.Unlock(ctx))
+}
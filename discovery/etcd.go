@@ -2,72 +2,117 @@ package discovery
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/panshiqu/golang/logger"
 	"github.com/panshiqu/golang/utils"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/client/v3/naming/endpoints"
 )
 
+const (
+	// 租约丢失后重新注册的初始延迟
+	minRetryDelay = time.Second
+
+	// 重新注册的最大延迟
+	maxRetryDelay = 30 * time.Second
+)
+
+// Event 注册状态变化
+type Event int
+
+const (
+	// Unregistered 租约丢失，服务已从发现中移除
+	Unregistered Event = iota
+
+	// Registered 重新注册成功
+	Registered
+)
+
+func (e Event) String() string {
+	switch e {
+	case Unregistered:
+		return "unregistered"
+	case Registered:
+		return "registered"
+	}
+	return fmt.Sprintf("Event(%d)", int(e))
+}
+
+// Service 会话上注册的服务
 type Service struct {
-	cli  *clientv3.Client
-	key  string
-	addr string
+	session *Session
+	owned   bool // NewService 创建的会话，释放服务时一并释放
+	key     string
+	addr    string
+	auto    bool
+
+	m  sync.Mutex
+	md Metadata
 }
 
 func Register(uri string, key string, addr string, id int) (*Service, error) {
-	slog.Info("register", slog.String("uri", uri), slog.String("key", key), slog.String("addr", addr), slog.Int("id", id))
+	return NewService(key, addr, id, WithEndpoints(uri))
+}
 
-	cli, err := clientv3.NewFromURL(uri)
+// NewService 按选项创建会话并注册服务，多个服务可共用 Session
+func NewService(key string, addr string, id int, opts ...Option) (*Service, error) {
+	sess, err := NewSession(opts...)
 	if err != nil {
 		return nil, utils.Wrap(err)
 	}
 
-	resp, err := cli.Grant(context.Background(), 60)
+	s, err := sess.Register(key, addr, id, opts...)
 	if err != nil {
+		logger.Error(sess.Release(), slog.Default(), "release")
 		return nil, utils.Wrap(err)
 	}
 
-	data, err := json.Marshal(endpoints.Endpoint{
-		Addr:     addr,
-		Metadata: fmt.Sprint(id),
-	})
-	if err != nil {
-		return nil, utils.Wrap(err)
-	}
+	s.owned = true
 
-	if _, err = cli.Put(context.Background(), fmt.Sprintf("discovery/%s/%s", key, addr), string(data), clientv3.WithLease(resp.ID)); err != nil {
-		return nil, utils.Wrap(err)
+	return s, nil
+}
+
+// Notify 设置注册状态变化回调，共用会话时对所有服务生效
+func (s *Service) Notify(fn func(Event)) {
+	s.session.Notify(fn)
+}
+
+// update 修改元数据并更新注册值，租约丢失时由重新注册写入，
+// 与重新注册串行，避免使用即将替换的租约写入
+func (s *Service) update(fn func(*Metadata)) error {
+	s.session.op.Lock()
+	defer s.session.op.Unlock()
+
+	if svc, ok := s.session.Service(s.key, s.addr); !ok || svc != s {
+		return utils.Wrap(fmt.Errorf("%s/%s not registered", s.key, s.addr))
 	}
 
-	ch, err := cli.KeepAlive(context.Background(), resp.ID)
+	s.m.Lock()
+	fn(&s.md)
+	val, err := encode(s.addr, &s.md)
+	s.m.Unlock()
 	if err != nil {
-		return nil, utils.Wrap(err)
+		return utils.Wrap(err)
 	}
 
-	go func() {
-		for v := range ch {
-			slog.Debug("keepalive", slog.Any("lease", v.ID))
-		}
+	ctx, cancel := context.WithTimeout(s.session.ctx, s.session.o.dialTimeout)
+	defer cancel()
 
-		slog.Info("keepalive exit", slog.Any("lease", resp.ID))
-	}()
+	if _, err := s.session.cli.Put(ctx, s.session.o.path("discovery", s.key, s.addr), val, clientv3.WithLease(s.session.leaseID())); err != nil {
+		return utils.Wrap(err)
+	}
 
-	return &Service{
-		cli:  cli,
-		key:  key,
-		addr: addr,
-	}, nil
+	return nil
 }
 
+// Release 注销服务，由 NewService 创建时同时释放会话
 func (s *Service) Release() error {
-	slog.Info("release", slog.String("key", s.key), slog.String("addr", s.addr))
-
-	if _, err := s.cli.Delete(context.Background(), fmt.Sprintf("discovery/%s/%s", s.key, s.addr)); err != nil {
-		return utils.Wrap(err)
+	if s.owned {
+		return utils.Wrap(s.session.Release())
 	}
 
-	return utils.Wrap(s.cli.Close())
+	return utils.Wrap(s.session.Deregister(s.key, s.addr))
 }
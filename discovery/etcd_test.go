@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// etcdOptions 需要etcd，例如 ETCD_ENDPOINTS=127.0.0.1:2379，每个测试使用独立前缀
+func etcdOptions(t *testing.T) []Option {
+	t.Helper()
+
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+
+	return []Option{
+		WithEndpoints(strings.Split(endpoints, ",")...),
+		WithPrefix("test/" + t.Name() + "/" + time.Now().Format("150405.000000000")),
+	}
+}
+
+func TestWatchUnixAddr(t *testing.T) {
+	opts := etcdOptions(t)
+
+	// 注册键为 unix:/tmp/a.sock
+	svc, err := NewService("game", "unix:///tmp/a.sock", 1, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := Watch(context.Background(), "game", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if instances := w.Instances(); len(instances) != 1 || instances[0].Addr != "unix:///tmp/a.sock" {
+		t.Fatalf("snapshot %v", instances)
+	}
+
+	if err := svc.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); c[0].Op != Delete || c[0].Instance.Addr != "unix:///tmp/a.sock" {
+		t.Fatalf("delete %v", c)
+	}
+	if instances := w.Instances(); len(instances) != 0 {
+		t.Fatalf("after delete %v", instances)
+	}
+}
+
+func TestEtcdRegistryUpdate(t *testing.T) {
+	r, err := NewEtcdRegistry(etcdOptions(t)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := r.Watch(context.Background(), "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// 已注册的地址视为更新
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 1, Zone: "z1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); len(c) != 1 || c[0].Op != Update || c[0].Instance.Metadata.Zone != "z1" {
+		t.Fatalf("update %v", c)
+	}
+
+	// 改用新的id后释放旧id
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); len(c) != 1 || c[0].Op != Update || c[0].Instance.Metadata.ID != 3 {
+		t.Fatalf("update id %v", c)
+	}
+	if err := r.Register(Instance{Key: "game", Addr: "a:2", Metadata: &Metadata{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 1}}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("duplicate %v", err)
+	}
+}
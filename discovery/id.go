@@ -0,0 +1,140 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+
+	"github.com/panshiqu/golang/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// AutoID 自动分配最小的空闲id，从1开始
+const AutoID = -1
+
+// 占用id的最大尝试次数
+const maxClaimAttempts = 10
+
+// ErrDuplicateID id已被其它地址占用
+var ErrDuplicateID = errors.New("duplicate id")
+
+// ID 注册使用的id，AutoID时为分配结果
+func (s *Service) ID() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.md.ID
+}
+
+// claim 在租约上占用id并写入注册值，键为 id/<key>/<id>，值为地址
+func (s *Service) claim(ctx context.Context, lease clientv3.LeaseID) error {
+	for range maxClaimAttempts {
+		s.m.Lock()
+		id := s.md.ID
+		s.m.Unlock()
+
+		if id == AutoID {
+			var err error
+			if id, err = s.freeID(ctx); err != nil {
+				return utils.Wrap(err)
+			}
+		}
+
+		ok, holder, err := s.put(ctx, lease, id)
+		if err != nil {
+			return utils.Wrap(err)
+		}
+		if ok {
+			if s.auto {
+				slog.Info("claim", slog.String("key", s.key), slog.String("addr", s.addr), slog.Int("id", id))
+			}
+			return nil
+		}
+		if holder == "" {
+			continue
+		}
+
+		if !s.auto {
+			return utils.Wrap(fmt.Errorf("%w: %s/%d held by %s", ErrDuplicateID, s.key, id, holder))
+		}
+
+		// 重新分配
+		s.m.Lock()
+		s.md.ID = AutoID
+		s.m.Unlock()
+	}
+
+	return utils.Wrap(fmt.Errorf("claim %s id: too many attempts", s.key))
+}
+
+// freeID 最小的空闲id
+func (s *Service) freeID(ctx context.Context) (int, error) {
+	resp, err := s.session.cli.Get(ctx, s.session.o.path("id", s.key)+"/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, utils.Wrap(err)
+	}
+
+	used := make(map[int]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if id, err := strconv.Atoi(path.Base(string(kv.Key))); err == nil {
+			used[id] = true
+		}
+	}
+
+	id := 1
+	for used[id] {
+		id++
+	}
+	return id, nil
+}
+
+// put id空闲或已被本地址占用时写入，被其它地址占用时返回占用者
+func (s *Service) put(ctx context.Context, lease clientv3.LeaseID, id int) (bool, string, error) {
+	s.m.Lock()
+	s.md.ID = id
+	val, err := encode(s.addr, &s.md)
+	s.m.Unlock()
+	if err != nil {
+		return false, "", utils.Wrap(err)
+	}
+
+	key := s.session.o.path("id", s.key, strconv.Itoa(id))
+	ops := []clientv3.Op{
+		clientv3.OpPut(key, s.addr, clientv3.WithLease(lease)),
+		clientv3.OpPut(s.session.o.path("discovery", s.key, s.addr), val, clientv3.WithLease(lease)),
+	}
+
+	resp, err := s.session.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(ops...).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return false, "", utils.Wrap(err)
+	}
+	if resp.Succeeded {
+		return true, "", nil
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		// 并发释放，重试
+		return false, "", nil
+	}
+	if holder := string(kvs[0].Value); holder != s.addr {
+		return false, holder, nil
+	}
+
+	// 本地址重启或重新注册时旧租约可能尚未过期
+	if resp, err = s.session.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", s.addr)).
+		Then(ops...).
+		Commit(); err != nil {
+		return false, "", utils.Wrap(err)
+	}
+
+	return resp.Succeeded, "", nil
+}
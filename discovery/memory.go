@@ -0,0 +1,188 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/panshiqu/golang/utils"
+)
+
+// MemoryRegistry 进程内实现，用于单元测试
+type MemoryRegistry struct {
+	m         sync.Mutex
+	instances map[string]map[string]Instance // key -> 地址 -> 实例
+	watchers  map[string]map[*Watcher]struct{}
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		instances: make(map[string]map[string]Instance),
+		watchers:  make(map[string]map[*Watcher]struct{}),
+	}
+}
+
+// NewStaticRegistry 从文件加载，用于本地开发，格式同etcd中的注册值
+//
+//	{"key": [{"Addr": "127.0.0.1:8080", "Metadata": {"id": 1}}]}
+func NewStaticRegistry(name string) (*MemoryRegistry, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	var m map[string][]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	r := NewMemoryRegistry()
+	for key, values := range m {
+		for _, v := range values {
+			addr, md, err := decode(v)
+			if err != nil {
+				return nil, utils.Wrap(err)
+			}
+
+			if err := r.Register(Instance{Key: key, Addr: addr, Metadata: md}); err != nil {
+				return nil, utils.Wrap(err)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// Register 已注册的地址视为更新
+func (r *MemoryRegistry) Register(ins Instance) error {
+	md := &Metadata{}
+	if ins.Metadata != nil {
+		*md = *ins.Metadata
+	}
+	if md.StartTime.IsZero() {
+		md.StartTime = time.Now()
+	}
+	ins.Metadata = md
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	instances, ok := r.instances[ins.Key]
+	if !ok {
+		instances = make(map[string]Instance)
+		r.instances[ins.Key] = instances
+	}
+
+	used := make(map[int]string, len(instances))
+	for _, v := range instances {
+		if v.Addr != ins.Addr {
+			used[v.Metadata.ID] = v.Addr
+		}
+	}
+
+	if md.ID == AutoID {
+		md.ID = 1
+		for used[md.ID] != "" {
+			md.ID++
+		}
+	} else if holder, ok := used[md.ID]; ok {
+		return utils.Wrap(fmt.Errorf("%w: %s/%d held by %s", ErrDuplicateID, ins.Key, md.ID, holder))
+	}
+
+	instances[ins.Addr] = ins
+
+	for w := range r.watchers[ins.Key] {
+		w.enqueue([]Change{{Op: Add, Instance: ins}})
+	}
+
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(key string, addr string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	ins, ok := r.instances[key][addr]
+	if !ok {
+		return nil
+	}
+
+	delete(r.instances[key], addr)
+
+	for w := range r.watchers[key] {
+		w.enqueue([]Change{{Op: Delete, Instance: ins}})
+	}
+
+	return nil
+}
+
+func (r *MemoryRegistry) Resolve(_ context.Context, key string) ([]Instance, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return sortInstances(r.instances[key]), nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, key string) (*Watcher, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	w := newWatcher(ctx, key)
+	w.instances = maps.Clone(r.instances[key])
+	if w.instances == nil {
+		w.instances = make(map[string]Instance)
+	}
+
+	if _, ok := r.watchers[key]; !ok {
+		r.watchers[key] = make(map[*Watcher]struct{})
+	}
+	r.watchers[key][w] = struct{}{}
+
+	// 持锁时只入队，由单独的协程发送，未读取 Changes 时不阻塞注册
+	w.wake = make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.pump()
+	}()
+
+	stop := sync.OnceFunc(func() {
+		r.m.Lock()
+		defer r.m.Unlock()
+
+		delete(r.watchers[key], w)
+	})
+	context.AfterFunc(w.ctx, stop)
+
+	w.stop = func() error {
+		stop()
+		<-done
+		return nil
+	}
+
+	return w, nil
+}
+
+// Close 关闭所有 Watcher
+func (r *MemoryRegistry) Close() error {
+	r.m.Lock()
+	var watchers []*Watcher
+	for _, m := range r.watchers {
+		for w := range m {
+			watchers = append(watchers, w)
+		}
+	}
+	r.m.Unlock()
+
+	for _, w := range watchers {
+		if err := w.Close(); err != nil {
+			return utils.Wrap(err)
+		}
+	}
+
+	return nil
+}
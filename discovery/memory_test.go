@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry()
+	defer r.Close()
+
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := r.Watch(context.Background(), "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances := w.Instances(); len(instances) != 1 || instances[0].Addr != "a:1" {
+		t.Fatalf("snapshot %v", instances)
+	}
+
+	if err := r.Register(Instance{Key: "game", Addr: "a:2", Metadata: &Metadata{ID: AutoID}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); c[0].Op != Add || c[0].Instance.Metadata.ID != 2 {
+		t.Fatalf("add %v", c)
+	}
+
+	if err := r.Register(Instance{Key: "game", Addr: "a:3", Metadata: &Metadata{ID: 2}}); !errors.Is(err, ErrDuplicateID) {
+		t.Fatalf("duplicate %v", err)
+	}
+
+	if err := r.Register(Instance{Key: "game", Addr: "a:1", Metadata: &Metadata{ID: 1, Zone: "z1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); c[0].Op != Update || c[0].Instance.Metadata.Zone != "z1" {
+		t.Fatalf("update %v", c)
+	}
+
+	if err := r.Deregister("game", "a:2"); err != nil {
+		t.Fatal(err)
+	}
+	if c := <-w.Changes(); c[0].Op != Delete || c[0].Instance.Addr != "a:2" {
+		t.Fatalf("delete %v", c)
+	}
+
+	instances, err := r.Resolve(context.Background(), "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Addr != "a:1" {
+		t.Fatalf("resolve %v", instances)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Changes(); ok {
+		t.Fatal("changes not closed")
+	}
+}
+
+func TestMemoryRegistryUnread(t *testing.T) {
+	r := NewMemoryRegistry()
+	defer r.Close()
+
+	w, err := r.Watch(context.Background(), "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过 Changes 的缓冲仍不阻塞注册
+	for i := 1; i <= 20; i++ {
+		if err := r.Register(Instance{Key: "game", Addr: fmt.Sprintf("a:%d", i), Metadata: &Metadata{ID: AutoID}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if instances, err := r.Resolve(context.Background(), "game"); err != nil || len(instances) != 20 {
+		t.Fatalf("resolve %d %v", len(instances), err)
+	}
+
+	// 按顺序收到全部变化
+	for i := 1; i <= 20; i++ {
+		if c := <-w.Changes(); c[0].Op != Add || c[0].Instance.Metadata.ID != i {
+			t.Fatalf("add %d %v", i, c)
+		}
+	}
+}
+
+func TestStaticRegistry(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "registry.json")
+	data := `{"game": [{"Addr": "a:1", "Metadata": {"id": 1, "zone": "z1"}}, {"Addr": "a:2", "Metadata": "2"}]}`
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewStaticRegistry(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := r.Resolve(context.Background(), "game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0].Metadata.Zone != "z1" || instances[1].Metadata.ID != 2 {
+		t.Fatalf("resolve %v", instances)
+	}
+}
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/panshiqu/golang/utils"
+	"google.golang.org/grpc/resolver"
+)
+
+// Metadata 服务元数据，存储在 endpoints.Endpoint.Metadata
+type Metadata struct {
+	ID        int               `json:"id"`
+	Version   string            `json:"version,omitempty"`
+	Zone      string            `json:"zone,omitempty"`
+	Weight    int               `json:"weight,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	StartTime time.Time         `json:"start_time"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Draining  bool              `json:"draining,omitempty"` // 排空中，不再参与轮询
+	Status    Status            `json:"status,omitempty"`
+}
+
+// Equal 供 attributes.Attributes 比较
+func (md *Metadata) Equal(o any) bool {
+	v, ok := o.(*Metadata)
+	if !ok {
+		return false
+	}
+	if md == nil || v == nil {
+		return md == v
+	}
+	return md.ID == v.ID &&
+		md.Version == v.Version &&
+		md.Zone == v.Zone &&
+		md.Weight == v.Weight &&
+		slices.Equal(md.Tags, v.Tags) &&
+		md.StartTime.Equal(v.StartTime) &&
+		maps.Equal(md.Labels, v.Labels) &&
+		md.Draining == v.Draining &&
+		md.Status == v.Status
+}
+
+type metadataKey struct{}
+
+// SetMetadata 附加元数据到地址，供负载均衡使用
+func SetMetadata(addr resolver.Address, md *Metadata) resolver.Address {
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(metadataKey{}, md)
+	return addr
+}
+
+// GetMetadata 取出地址上附加的元数据
+func GetMetadata(addr resolver.Address) (*Metadata, bool) {
+	md, ok := addr.BalancerAttributes.Value(metadataKey{}).(*Metadata)
+	return md, ok
+}
+
+// EndpointMetadata 解析 etcd naming/resolver 传入 resolver.Address.Metadata 的值，
+// 即 json 解码后的 map[string]any，其它类型返回false
+func EndpointMetadata(v any) (*Metadata, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, false
+	}
+
+	md := &Metadata{}
+	if err := json.Unmarshal(data, md); err != nil {
+		return nil, false
+	}
+	return md, true
+}
+
+// endpoint 同 endpoints.Endpoint，元数据为 Metadata
+type endpoint struct {
+	Addr     string
+	Metadata json.RawMessage
+}
+
+func encode(addr string, md *Metadata) (string, error) {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return "", utils.Wrap(err)
+	}
+
+	data, err = json.Marshal(endpoint{
+		Addr:     addr,
+		Metadata: data,
+	})
+	if err != nil {
+		return "", utils.Wrap(err)
+	}
+
+	return string(data), nil
+}
+
+// decode 兼容元数据仅为id字符串的旧格式
+func decode(data []byte) (string, *Metadata, error) {
+	var ep endpoint
+	if err := json.Unmarshal(data, &ep); err != nil {
+		return "", nil, utils.Wrap(err)
+	}
+
+	md := &Metadata{}
+	if len(ep.Metadata) == 0 {
+		return ep.Addr, md, nil
+	}
+
+	var id string
+	if err := json.Unmarshal(ep.Metadata, &id); err == nil {
+		if md.ID, err = utils.String2Int[int](id); err != nil {
+			return "", nil, utils.Wrap(err)
+		}
+		return ep.Addr, md, nil
+	}
+
+	if err := json.Unmarshal(ep.Metadata, md); err != nil {
+		return "", nil, utils.Wrap(err)
+	}
+
+	return ep.Addr, md, nil
+}
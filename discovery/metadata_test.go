@@ -0,0 +1,29 @@
+package discovery
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+)
+
+func TestEndpointMetadata(t *testing.T) {
+	val, err := encode("a:1", &Metadata{ID: 7, Zone: "z1", Labels: map[string]string{"room": "r7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// etcd naming/resolver 解码得到的 Metadata 为 map[string]any
+	var ep endpoints.Endpoint
+	if err := json.Unmarshal([]byte(val), &ep); err != nil {
+		t.Fatal(err)
+	}
+	md, ok := EndpointMetadata(ep.Metadata)
+	if !ok || md.ID != 7 || md.Zone != "z1" || md.Labels["room"] != "r7" {
+		t.Fatalf("metadata %v %v", md, ok)
+	}
+
+	if _, ok := EndpointMetadata("7"); ok {
+		t.Fatal("string metadata")
+	}
+}
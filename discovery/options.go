@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"path"
+	"time"
+
+	"github.com/panshiqu/golang/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type options struct {
+	cli         *clientv3.Client
+	ctx         context.Context
+	endpoints   []string
+	dialTimeout time.Duration
+	tls         *tls.Config
+	username    string
+	password    string
+	prefix      string
+	ttl         int64
+	notify      func(Event)
+	md          Metadata
+}
+
+type Option func(*options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		ctx:         context.Background(),
+		dialTimeout: 5 * time.Second,
+		ttl:         60,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// path 拼接键并加上前缀
+func (o *options) path(elem ...string) string {
+	return path.Join(append([]string{o.prefix}, elem...)...)
+}
+
+// WithClient 复用已有客户端，不会被关闭，连接相关选项不再生效
+func WithClient(cli *clientv3.Client) Option {
+	return func(o *options) {
+		o.cli = cli
+	}
+}
+
+// WithContext 调用方上下文，取消后停止续约
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithEndpoints etcd地址，支持多个
+func WithEndpoints(endpoints ...string) Option {
+	return func(o *options) {
+		o.endpoints = append(o.endpoints, endpoints...)
+	}
+}
+
+// WithDialTimeout 连接及注册请求超时，默认5秒
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = d
+	}
+}
+
+// WithTLS 启用TLS
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tls = cfg
+	}
+}
+
+// WithAuth 用户名密码认证
+func WithAuth(username, password string) Option {
+	return func(o *options) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithPrefix 所有键的前缀，用于多个环境共用etcd
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithTTL 租约时长，默认60秒，越短故障转移越快
+func WithTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.ttl = max(int64(d/time.Second), 1)
+	}
+}
+
+// WithNotify 注册状态变化回调，同 Service.Notify
+func WithNotify(fn func(Event)) Option {
+	return func(o *options) {
+		o.notify = fn
+	}
+}
+
+// WithMetadata 注册时附带的元数据，ID和StartTime由注册填充
+func WithMetadata(md Metadata) Option {
+	return func(o *options) {
+		o.md = md
+	}
+}
+
+// NewClient 按选项创建etcd客户端，owned 为true时由调用方关闭，
+// WithClient 时直接返回且 owned 为false
+func NewClient(opts ...Option) (cli *clientv3.Client, owned bool, err error) {
+	return newOptions(opts...).client()
+}
+
+// Key 供其它包复用键前缀
+func Key(key string, opts ...Option) string {
+	return newOptions(opts...).path(key)
+}
+
+// client WithClient 时复用，否则新建，owned 表示需要关闭
+func (o *options) client() (cli *clientv3.Client, owned bool, err error) {
+	if o.cli != nil {
+		return o.cli, false, nil
+	}
+
+	if cli, err = newClient(o); err != nil {
+		return nil, false, utils.Wrap(err)
+	}
+	return cli, true, nil
+}
+
+func newClient(o *options) (*clientv3.Client, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   o.endpoints,
+		DialTimeout: o.dialTimeout,
+		TLS:         o.tls,
+		Username:    o.username,
+		Password:    o.password,
+	})
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+	return cli, nil
+}
@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Registry 注册中心，各实现使用相同的 Instance 和 Metadata
+type Registry interface {
+	// Register 注册实例，Metadata.ID 为 AutoID 时自动分配
+	Register(ins Instance) error
+
+	Deregister(key string, addr string) error
+
+	// Resolve 当前已注册的实例，按地址排序
+	Resolve(ctx context.Context, key string) ([]Instance, error)
+
+	// Watch 返回时已加载当前快照
+	Watch(ctx context.Context, key string) (*Watcher, error)
+
+	Close() error
+}
+
+// EtcdRegistry 基于etcd，所有实例共用一个 Session，首次注册时创建
+type EtcdRegistry struct {
+	cli   *clientv3.Client
+	owned bool
+	o     *options
+	opts  []Option
+
+	m       sync.Mutex
+	session *Session
+}
+
+func NewEtcdRegistry(opts ...Option) (*EtcdRegistry, error) {
+	o := newOptions(opts...)
+
+	cli, owned, err := o.client()
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	return newEtcdRegistry(cli, owned, o, opts...), nil
+}
+
+func newEtcdRegistry(cli *clientv3.Client, owned bool, o *options, opts ...Option) *EtcdRegistry {
+	return &EtcdRegistry{
+		cli:   cli,
+		owned: owned,
+		o:     o,
+		opts:  append(slices.Clip(opts), WithClient(cli)),
+	}
+}
+
+// Register 已注册的地址视为更新，id为 AutoID 或不变时沿用当前id
+func (r *EtcdRegistry) Register(ins Instance) error {
+	var md Metadata
+	if ins.Metadata != nil {
+		md = *ins.Metadata
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.session == nil {
+		s, err := NewSession(r.opts...)
+		if err != nil {
+			return utils.Wrap(err)
+		}
+		r.session = s
+	}
+
+	if svc, ok := r.session.Service(ins.Key, ins.Addr); ok {
+		if md.ID != AutoID && md.ID != svc.ID() {
+			return utils.Wrap(r.session.reclaim(svc, md))
+		}
+
+		return utils.Wrap(svc.update(func(m *Metadata) {
+			id, start := m.ID, m.StartTime
+			*m = md
+			m.ID = id
+			if m.StartTime.IsZero() {
+				m.StartTime = start
+			}
+		}))
+	}
+
+	if _, err := r.session.Register(ins.Key, ins.Addr, md.ID, WithMetadata(md)); err != nil {
+		return utils.Wrap(err)
+	}
+
+	return nil
+}
+
+func (r *EtcdRegistry) Deregister(key string, addr string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.session == nil {
+		return nil
+	}
+
+	return utils.Wrap(r.session.Deregister(key, addr))
+}
+
+// Service 已注册实例对应的 Service，用于排空等etcd特有操作
+func (r *EtcdRegistry) Service(key string, addr string) (*Service, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.session == nil {
+		return nil, false
+	}
+
+	return r.session.Service(key, addr)
+}
+
+func (r *EtcdRegistry) Resolve(ctx context.Context, key string) ([]Instance, error) {
+	instances, _, _, err := load(ctx, r.cli, key, r.o.path("discovery", key)+"/")
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	return sortInstances(instances), nil
+}
+
+func (r *EtcdRegistry) Watch(ctx context.Context, key string) (*Watcher, error) {
+	return watch(ctx, r.cli, r.o, key)
+}
+
+// Close 在一个事务中注销所有已注册的实例
+func (r *EtcdRegistry) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.session != nil {
+		logger.Error(r.session.Release(), slog.Default(), "release")
+		r.session = nil
+	}
+
+	if r.owned {
+		return utils.Wrap(r.cli.Close())
+	}
+	return nil
+}
+
+func sortInstances(instances map[string]Instance) []Instance {
+	return slices.SortedFunc(maps.Values(instances), func(a, b Instance) int {
+		return cmp.Compare(a.Addr, b.Addr)
+	})
+}
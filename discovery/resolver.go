@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme 解析器协议
+//
+//	grpc.NewClient("discovery://127.0.0.1:2379/key")
+//	grpc.NewClient("discovery:///key", grpc.WithResolvers(discovery.NewBuilder(cli)))
+const Scheme = "discovery"
+
+// ReloadDelay 加载失败时重新加载延迟，监听etcd的其它包共用
+const ReloadDelay = 5 * time.Second
+
+func init() {
+	resolver.Register(&builder{o: newOptions()})
+}
+
+type builder struct {
+	registry Registry
+	o        *options
+}
+
+// NewBuilder 复用已有客户端，地址中可省略etcd地址，选项仅前缀生效
+func NewBuilder(cli *clientv3.Client, opts ...Option) resolver.Builder {
+	o := newOptions(opts...)
+	return &builder{registry: newEtcdRegistry(cli, false, o, opts...), o: o}
+}
+
+// NewRegistryBuilder 从任意注册中心解析，地址中可省略etcd地址
+func NewRegistryBuilder(r Registry) resolver.Builder {
+	return &builder{registry: r, o: newOptions()}
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	key := target.Endpoint()
+	if key == "" {
+		return nil, utils.Wrap(fmt.Errorf("missing key in target %s", target))
+	}
+
+	r := &registryResolver{
+		registry: b.registry,
+		key:      key,
+		cc:       cc,
+		done:     make(chan struct{}),
+	}
+
+	if r.registry == nil {
+		if target.URL.Host == "" {
+			return nil, utils.Wrap(fmt.Errorf("missing etcd address in target %s", target))
+		}
+
+		o := *b.o
+		o.endpoints = strings.Split(target.URL.Host, ",")
+
+		cli, err := newClient(&o)
+		if err != nil {
+			return nil, utils.Wrap(err)
+		}
+
+		r.registry = newEtcdRegistry(cli, true, &o)
+		r.owned = true
+	}
+
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	go r.watch()
+
+	return r, nil
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+type registryResolver struct {
+	registry Registry
+	owned    bool
+	key      string
+	cc       resolver.ClientConn
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (r *registryResolver) watch() {
+	defer close(r.done)
+
+	for r.ctx.Err() == nil {
+		w, err := r.registry.Watch(r.ctx, r.key)
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+
+			slog.Error("resolver watch", slog.String("key", r.key), slog.Any("err", err))
+			r.cc.ReportError(err)
+
+			select {
+			case <-time.After(ReloadDelay):
+			case <-r.ctx.Done():
+			}
+			continue
+		}
+
+		r.update(w.Instances())
+		for range w.Changes() {
+			r.update(w.Instances())
+		}
+
+		logger.Error(w.Close(), slog.Default(), "resolver watch close")
+	}
+}
+
+func (r *registryResolver) update(instances []Instance) {
+	addrs := make([]resolver.Address, 0, len(instances))
+	for _, ins := range instances {
+		// 暂停服务的实例不交给负载均衡
+		if ins.Metadata.Status == NotServing {
+			continue
+		}
+		addrs = append(addrs, SetMetadata(resolver.Address{Addr: ins.Addr}, ins.Metadata))
+	}
+
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		slog.Debug("resolver update", slog.String("key", r.key), slog.Any("err", err))
+	}
+}
+
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+	<-r.done
+
+	if r.owned {
+		logger.Error(r.registry.Close(), slog.Default(), "resolver close")
+	}
+}
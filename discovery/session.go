@@ -0,0 +1,371 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Session 共用一个客户端和一个租约注册多个服务，租约丢失后全部重新注册
+type Session struct {
+	cli   *clientv3.Client
+	owned bool
+	o     *options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// 串行化注册、注销、重新注册和释放
+	op sync.Mutex
+
+	m        sync.Mutex
+	lease    clientv3.LeaseID
+	services map[string]*Service // discovery/<key>/<addr> -> 服务
+	notify   func(Event)
+
+	// 回调在单独的协程中按顺序执行，回调中可以调用 Release
+	events chan Event
+}
+
+// NewSession 创建客户端并申请租约
+func NewSession(opts ...Option) (*Session, error) {
+	o := newOptions(opts...)
+
+	cli, owned, err := o.client()
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	ctx, cancel := context.WithCancel(o.ctx)
+
+	s := &Session{
+		cli:      cli,
+		owned:    owned,
+		o:        o,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		services: make(map[string]*Service),
+		notify:   o.notify,
+		events:   make(chan Event, 2),
+	}
+
+	ch, err := s.grant()
+	if err != nil {
+		cancel()
+		if owned {
+			logger.Error(cli.Close(), slog.Default(), "close")
+		}
+		return nil, utils.Wrap(err)
+	}
+
+	go s.keepAlive(ch)
+	go s.dispatch()
+
+	return s, nil
+}
+
+// Register 在会话租约上注册服务，选项中仅 WithMetadata 生效
+func (s *Session) Register(key string, addr string, id int, opts ...Option) (*Service, error) {
+	slog.Info("register", slog.Any("endpoints", s.o.endpoints), slog.String("key", key), slog.String("addr", addr), slog.Int("id", id))
+
+	md := newOptions(opts...).md
+	md.ID = id
+	md.StartTime = time.Now()
+
+	svc := &Service{
+		session: s,
+		key:     key,
+		addr:    addr,
+		auto:    id == AutoID,
+		md:      md,
+	}
+
+	s.op.Lock()
+	defer s.op.Unlock()
+
+	k := s.o.path("discovery", key, addr)
+
+	s.m.Lock()
+	_, ok := s.services[k]
+	lease := s.lease
+	s.m.Unlock()
+	if ok {
+		return nil, utils.Wrap(fmt.Errorf("%s/%s already registered", key, addr))
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.o.dialTimeout)
+	defer cancel()
+
+	if err := svc.claim(ctx, lease); err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	s.m.Lock()
+	s.services[k] = svc
+	s.m.Unlock()
+
+	return svc, nil
+}
+
+// Deregister 注销服务，删除注册值和占用的id，租约不受影响
+func (s *Session) Deregister(key string, addr string) error {
+	slog.Info("deregister", slog.String("key", key), slog.String("addr", addr))
+
+	s.op.Lock()
+	defer s.op.Unlock()
+
+	k := s.o.path("discovery", key, addr)
+
+	s.m.Lock()
+	svc, ok := s.services[k]
+	delete(s.services, k)
+	s.m.Unlock()
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.o.dialTimeout)
+	defer cancel()
+
+	if _, err := s.cli.Txn(ctx).Then(svc.deleteOps()...).Commit(); err != nil {
+		return utils.Wrap(err)
+	}
+
+	return nil
+}
+
+// reclaim 已注册的服务改用新的id和元数据，占用成功后释放旧id，失败时保持不变
+func (s *Session) reclaim(svc *Service, md Metadata) error {
+	s.op.Lock()
+	defer s.op.Unlock()
+
+	s.m.Lock()
+	cur, ok := s.services[s.o.path("discovery", svc.key, svc.addr)]
+	lease := s.lease
+	s.m.Unlock()
+	if !ok || cur != svc {
+		return utils.Wrap(fmt.Errorf("%s/%s not registered", svc.key, svc.addr))
+	}
+
+	svc.m.Lock()
+	prev := svc.md
+	if md.StartTime.IsZero() {
+		md.StartTime = prev.StartTime
+	}
+	svc.md = md
+	svc.m.Unlock()
+
+	auto := svc.auto
+	svc.auto = false
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.o.dialTimeout)
+	defer cancel()
+
+	if err := svc.claim(ctx, lease); err != nil {
+		svc.m.Lock()
+		svc.md = prev
+		svc.m.Unlock()
+		svc.auto = auto
+		return utils.Wrap(err)
+	}
+
+	key := s.o.path("id", svc.key, strconv.Itoa(prev.ID))
+	if _, err := s.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", svc.addr)).
+		Then(clientv3.OpDelete(key)).
+		Commit(); err != nil {
+		return utils.Wrap(err)
+	}
+
+	return nil
+}
+
+// Service 已注册的服务
+func (s *Session) Service(key string, addr string) (*Service, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	svc, ok := s.services[s.o.path("discovery", key, addr)]
+	return svc, ok
+}
+
+// Notify 设置注册状态变化回调，对会话内所有服务生效，回调中可以调用 Release
+func (s *Session) Notify(fn func(Event)) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.notify = fn
+}
+
+// emit 交给 dispatch 执行回调，释放时放弃
+func (s *Session) emit(e Event) {
+	select {
+	case s.events <- e:
+	case <-s.ctx.Done():
+	}
+}
+
+// dispatch 执行回调，直到 keepAlive 退出
+func (s *Session) dispatch() {
+	for e := range s.events {
+		s.m.Lock()
+		fn := s.notify
+		s.m.Unlock()
+
+		if fn != nil {
+			fn(e)
+		}
+	}
+}
+
+func (s *Session) leaseID() clientv3.LeaseID {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.lease
+}
+
+// grant 申请新租约并重新占用所有服务，任一失败则撤销
+func (s *Session) grant() (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	s.op.Lock()
+	defer s.op.Unlock()
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.o.dialTimeout)
+	defer cancel()
+
+	resp, err := s.cli.Grant(ctx, s.o.ttl)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	s.m.Lock()
+	services := make([]*Service, 0, len(s.services))
+	for _, svc := range s.services {
+		services = append(services, svc)
+	}
+	s.m.Unlock()
+
+	for _, svc := range services {
+		if err := svc.claim(ctx, resp.ID); err != nil {
+			if _, err := s.cli.Revoke(ctx, resp.ID); err != nil {
+				slog.Error("revoke", slog.Any("lease", resp.ID), slog.Any("err", err))
+			}
+			return nil, utils.Wrap(err)
+		}
+	}
+
+	s.m.Lock()
+	s.lease = resp.ID
+	s.m.Unlock()
+
+	ch, err := s.cli.KeepAlive(s.ctx, resp.ID)
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	return ch, nil
+}
+
+// keepAlive 续约通道关闭时重新注册，直到释放
+func (s *Session) keepAlive(ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer close(s.done)
+	defer close(s.events)
+
+	for {
+		var lease clientv3.LeaseID
+		for v := range ch {
+			lease = v.ID
+			slog.Debug("keepalive", slog.Any("lease", v.ID))
+		}
+
+		if s.ctx.Err() != nil {
+			slog.Info("keepalive exit", slog.Any("lease", lease))
+			return
+		}
+
+		slog.Warn("keepalive lost", slog.Any("lease", lease))
+		s.emit(Unregistered)
+
+		for delay := minRetryDelay; ; delay = min(delay*2, maxRetryDelay) {
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+				return
+			}
+
+			var err error
+			if ch, err = s.grant(); err == nil {
+				break
+			}
+
+			slog.Error("reregister", slog.Any("err", err))
+		}
+
+		slog.Info("reregister", slog.Any("lease", s.leaseID()))
+		s.emit(Registered)
+	}
+}
+
+// Release 在一个事务中删除所有注册值和占用的id，然后撤销租约
+func (s *Session) Release() error {
+	slog.Info("release", slog.Any("lease", s.leaseID()))
+
+	s.cancel()
+	<-s.done
+
+	s.op.Lock()
+	defer s.op.Unlock()
+
+	s.m.Lock()
+	var ops []clientv3.Op
+	for k, svc := range s.services {
+		ops = append(ops, svc.deleteOps()...)
+		delete(s.services, k)
+	}
+	lease := s.lease
+	s.m.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.o.dialTimeout)
+	defer cancel()
+
+	if len(ops) > 0 {
+		if _, err := s.cli.Txn(ctx).Then(ops...).Commit(); err != nil {
+			slog.Error("release txn", slog.Any("err", err))
+		}
+	}
+
+	// 撤销租约同时删除事务失败时遗留的键
+	if _, err := s.cli.Revoke(ctx, lease); err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return utils.Wrap(err)
+	}
+
+	if s.owned {
+		return utils.Wrap(s.cli.Close())
+	}
+	return nil
+}
+
+// deleteOps 删除注册值，id仍由本地址占用时一并删除
+func (s *Service) deleteOps() []clientv3.Op {
+	key := s.session.o.path("id", s.key, strconv.Itoa(s.ID()))
+
+	return []clientv3.Op{
+		clientv3.OpDelete(s.session.o.path("discovery", s.key, s.addr)),
+		clientv3.OpTxn(
+			[]clientv3.Cmp{clientv3.Compare(clientv3.Value(key), "=", s.addr)},
+			[]clientv3.Op{clientv3.OpDelete(key)},
+			nil,
+		),
+	}
+}
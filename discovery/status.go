@@ -0,0 +1,41 @@
+package discovery
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/panshiqu/golang/utils"
+)
+
+// Status 健康状态
+type Status int
+
+const (
+	// Serving 正常服务
+	Serving Status = iota
+
+	// Degraded 降级，仍然参与负载均衡
+	Degraded
+
+	// NotServing 暂停服务，解析时排除
+	NotServing
+)
+
+func (s Status) String() string {
+	switch s {
+	case Serving:
+		return "serving"
+	case Degraded:
+		return "degraded"
+	case NotServing:
+		return "not_serving"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// SetStatus 更新注册值中的健康状态，例如服务器满员或数据库不可用
+func (s *Service) SetStatus(st Status) error {
+	slog.Info("status", slog.String("key", s.key), slog.String("addr", s.addr), slog.Any("status", st))
+
+	return utils.Wrap(s.update(func(md *Metadata) { md.Status = st }))
+}
@@ -0,0 +1,349 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/panshiqu/golang/logger"
+	"github.com/panshiqu/golang/utils"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Instance 已注册的服务实例
+type Instance struct {
+	Key      string
+	Addr     string
+	Metadata *Metadata
+}
+
+// Op 成员变化类型
+type Op int
+
+const (
+	Add Op = iota
+	Update
+	Delete
+)
+
+func (op Op) String() string {
+	switch op {
+	case Add:
+		return "add"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Change 成员变化，删除时为删除前的实例
+type Change struct {
+	Op       Op
+	Instance Instance
+}
+
+// Watcher 监听服务成员变化，由注册中心实现驱动
+type Watcher struct {
+	key string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	m         sync.Mutex
+	instances map[string]Instance // 地址 -> 实例
+
+	ch chan []Change
+
+	// 持锁时通知的变化，由 pump 按顺序发送，避免阻塞注册中心
+	qm     sync.Mutex
+	queued [][]Change
+	wake   chan struct{}
+
+	// 注册中心的清理，需关闭ch
+	stop func() error
+}
+
+func newWatcher(ctx context.Context, key string) *Watcher {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &Watcher{
+		key:       key,
+		ctx:       ctx,
+		cancel:    cancel,
+		instances: make(map[string]Instance),
+		ch:        make(chan []Change, 16),
+	}
+}
+
+// Watch 监听etcd中 discovery/<key>/ 下的成员变化，返回时已加载当前快照
+func Watch(ctx context.Context, key string, opts ...Option) (*Watcher, error) {
+	o := newOptions(opts...)
+
+	cli, owned, err := o.client()
+	if err != nil {
+		return nil, utils.Wrap(err)
+	}
+
+	w, err := watch(ctx, cli, o, key)
+	if err != nil {
+		if owned {
+			logger.Error(cli.Close(), slog.Default(), "close")
+		}
+		return nil, utils.Wrap(err)
+	}
+
+	if owned {
+		stop := w.stop
+		w.stop = func() error {
+			logger.Error(stop(), slog.Default(), "watch stop")
+			return utils.Wrap(cli.Close())
+		}
+	}
+
+	return w, nil
+}
+
+// Instances 当前快照，按地址排序
+func (w *Watcher) Instances() []Instance {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return sortInstances(w.instances)
+}
+
+// Changes 成员变化，Close 后关闭
+func (w *Watcher) Changes() <-chan []Change {
+	return w.ch
+}
+
+func (w *Watcher) Close() error {
+	w.cancel()
+	return utils.Wrap(w.stop())
+}
+
+// apply 应用增量变化并发送
+func (w *Watcher) apply(changes []Change) {
+	w.publish(w.update(changes))
+}
+
+// update 应用增量变化，已存在的新增视为更新，不存在的删除忽略
+func (w *Watcher) update(changes []Change) []Change {
+	applied := make([]Change, 0, len(changes))
+
+	w.m.Lock()
+	for _, c := range changes {
+		old, ok := w.instances[c.Instance.Addr]
+		switch c.Op {
+		case Add, Update:
+			c.Op = Add
+			if ok {
+				c.Op = Update
+			}
+			w.instances[c.Instance.Addr] = c.Instance
+		case Delete:
+			if !ok {
+				continue
+			}
+			c.Instance = old
+			delete(w.instances, c.Instance.Addr)
+		}
+		applied = append(applied, c)
+	}
+	w.m.Unlock()
+
+	return applied
+}
+
+// enqueue 应用增量变化，不阻塞，由 pump 发送
+func (w *Watcher) enqueue(changes []Change) {
+	applied := w.update(changes)
+	if len(applied) == 0 {
+		return
+	}
+
+	w.qm.Lock()
+	w.queued = append(w.queued, applied)
+	w.qm.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump 按顺序发送 enqueue 的变化，直到关闭
+func (w *Watcher) pump() {
+	defer close(w.ch)
+
+	for {
+		select {
+		case <-w.wake:
+		case <-w.ctx.Done():
+			return
+		}
+
+		w.qm.Lock()
+		queued := w.queued
+		w.queued = nil
+		w.qm.Unlock()
+
+		for _, changes := range queued {
+			w.publish(changes)
+		}
+	}
+}
+
+// reset 替换全量快照，与当前快照比较得出变化
+func (w *Watcher) reset(instances map[string]Instance) {
+	var changes []Change
+
+	w.m.Lock()
+	for addr, ins := range w.instances {
+		if _, ok := instances[addr]; !ok {
+			changes = append(changes, Change{Op: Delete, Instance: ins})
+		}
+	}
+	for addr, ins := range instances {
+		if old, ok := w.instances[addr]; !ok {
+			changes = append(changes, Change{Op: Add, Instance: ins})
+		} else if !old.Metadata.Equal(ins.Metadata) {
+			changes = append(changes, Change{Op: Update, Instance: ins})
+		}
+	}
+	w.instances = instances
+	w.m.Unlock()
+
+	w.publish(changes)
+}
+
+func (w *Watcher) publish(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	select {
+	case w.ch <- changes:
+	case <-w.ctx.Done():
+	}
+}
+
+// watch 监听etcd，压缩或断开时重新加载全量
+func watch(ctx context.Context, cli *clientv3.Client, o *options, key string) (*Watcher, error) {
+	w := newWatcher(ctx, key)
+	prefix := o.path("discovery", key) + "/"
+
+	// 注册键由 path.Join 生成，可能与地址不同，例如 unix:///tmp/a.sock，删除时按注册键查找地址
+	instances, addrs, rev, err := load(w.ctx, cli, key, prefix)
+	if err != nil {
+		w.cancel()
+		return nil, utils.Wrap(err)
+	}
+	w.instances = instances
+
+	done := make(chan struct{})
+	w.stop = func() error {
+		<-done
+		return nil
+	}
+
+	go func() {
+		defer close(done)
+		defer close(w.ch)
+
+		for w.ctx.Err() == nil {
+			if rev == 0 {
+				if instances, addrs, rev, err = load(w.ctx, cli, key, prefix); err != nil {
+					if w.ctx.Err() != nil {
+						return
+					}
+
+					slog.Error("watch load", slog.String("prefix", prefix), slog.Any("err", err))
+
+					select {
+					case <-time.After(ReloadDelay):
+					case <-w.ctx.Done():
+					}
+					continue
+				}
+				w.reset(instances)
+			}
+
+			wch := cli.Watch(clientv3.WithRequireLeader(w.ctx), prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+			for resp := range wch {
+				if err := resp.Err(); err != nil {
+					slog.Warn("watch", slog.String("prefix", prefix), slog.Any("err", err))
+					break
+				}
+
+				changes := make([]Change, 0, len(resp.Events))
+				for _, ev := range resp.Events {
+					switch ev.Type {
+					case clientv3.EventTypePut:
+						ins, err := instance(key, ev.Kv)
+						if err != nil {
+							slog.Error("watch decode", slog.String("key", string(ev.Kv.Key)), slog.Any("err", err))
+							continue
+						}
+						addrs[string(ev.Kv.Key)] = ins.Addr
+						changes = append(changes, Change{Op: Add, Instance: ins})
+					case clientv3.EventTypeDelete:
+						addr, ok := addrs[string(ev.Kv.Key)]
+						if !ok {
+							continue
+						}
+						delete(addrs, string(ev.Kv.Key))
+						changes = append(changes, Change{Op: Delete, Instance: Instance{
+							Key:  key,
+							Addr: addr,
+						}})
+					}
+				}
+				w.apply(changes)
+			}
+
+			rev = 0
+		}
+	}()
+
+	return w, nil
+}
+
+// load 全量加载并返回注册键到地址的索引和当前版本
+func load(ctx context.Context, cli *clientv3.Client, key string, prefix string) (map[string]Instance, map[string]string, int64, error) {
+	resp, err := cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, nil, 0, utils.Wrap(err)
+	}
+
+	instances := make(map[string]Instance, len(resp.Kvs))
+	addrs := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		ins, err := instance(key, kv)
+		if err != nil {
+			slog.Error("watch decode", slog.String("key", string(kv.Key)), slog.Any("err", err))
+			continue
+		}
+		instances[ins.Addr] = ins
+		addrs[string(kv.Key)] = ins.Addr
+	}
+
+	return instances, addrs, resp.Header.Revision, nil
+}
+
+func instance(key string, kv *mvccpb.KeyValue) (Instance, error) {
+	addr, md, err := decode(kv.Value)
+	if err != nil {
+		return Instance{}, utils.Wrap(err)
+	}
+
+	return Instance{
+		Key:      key,
+		Addr:     addr,
+		Metadata: md,
+	}, nil
+}